@@ -28,9 +28,8 @@ func UnmarshalGameEvent(data []byte) (*GameEvent, error) {
 	return &event, err
 }
 
-var globalStream EventStream
-
-func InitEventStream(streamType string, config map[string]string) error {
+// NewEventStream creates the event stream selected by streamType ("redis" or "kafka")
+func NewEventStream(streamType string, config map[string]string) (EventStream, error) {
 	var stream EventStream
 	var err error
 
@@ -44,23 +43,18 @@ func InitEventStream(streamType string, config map[string]string) error {
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	globalStream = stream
-	return nil
+	return stream, nil
 }
 
-func PublishGameCompleted(gameID, winner string, duration int64) error {
-	if globalStream == nil {
-		return nil
-	}
-	return globalStream.PublishGameCompleted(gameID, winner, duration)
+// NopStream discards all events; used when analytics are disabled
+type NopStream struct{}
+
+func (NopStream) PublishGameCompleted(gameID, winner string, duration int64) error {
+	return nil
 }
 
-func Close() error {
-	if globalStream != nil {
-		return globalStream.Close()
-	}
+func (NopStream) Close() error {
 	return nil
 }
@@ -0,0 +1,66 @@
+package auth
+
+// Role is what an account may do on the server. Clients without a session
+// are guests.
+type Role string
+
+const (
+	RoleGuest     Role = "guest"
+	RolePlayer    Role = "player"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission names an action that HTTP routes and WebSocket messages
+// declare they need
+type Permission string
+
+const (
+	PermPlay        Permission = "play"         // Matchmaking, moves and the lobby
+	PermAccount     Permission = "account"      // Friends, blocks, reports and linked logins
+	PermViewLive    Permission = "live:view"    // Live games, the queue and connections
+	PermModerate    Permission = "moderate"     // Kicks, bans and the report queue
+	PermOperate     Permission = "operate"      // Aborting games and server notices
+	PermManageRoles Permission = "roles:manage" // Changing account roles
+)
+
+// grants lists each role's permissions; every role has those of the roles
+// before it
+var grants = map[Role][]Permission{
+	RoleGuest:     {PermPlay},
+	RolePlayer:    {PermPlay, PermAccount},
+	RoleModerator: {PermPlay, PermAccount, PermViewLive, PermModerate},
+	RoleAdmin:     {PermPlay, PermAccount, PermViewLive, PermModerate, PermOperate, PermManageRoles},
+}
+
+// Roles are the roles an account can be given, least privileged first
+var Roles = []Role{RolePlayer, RoleModerator, RoleAdmin}
+
+// Can reports whether the role has a permission. Unknown roles have none.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range grants[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRole returns the account role named s
+func ParseRole(s string) (Role, bool) {
+	for _, r := range Roles {
+		if string(r) == s {
+			return r, true
+		}
+	}
+	return "", false
+}
+
+// AccountRole is the role stored on an account, which is a player until
+// given another
+func AccountRole(s string) Role {
+	if r, ok := ParseRole(s); ok {
+		return r
+	}
+	return RolePlayer
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// Token kinds, so one kind of token cannot be used as another
+const (
+	kindSession   = "session"
+	kindReconnect = "reconnect"
+	kindOIDCFlow  = "oidc"
+)
+
+// Claims identify the account a session token was issued to
+type Claims struct {
+	Kind      string `json:"typ"`
+	UserID    string `json:"sub"`
+	Username  string `json:"name"`
+	ExpiresAt int64  `json:"exp"` // Unix seconds
+}
+
+// ReconnectClaims identify the seat a reconnect token reclaims
+type ReconnectClaims struct {
+	Kind      string `json:"typ"`
+	GameID    string `json:"gid"`
+	PlayerID  string `json:"pid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// OIDCFlowClaims carry an OpenID Connect login from its start to the
+// provider's callback
+type OIDCFlowClaims struct {
+	Kind       string `json:"typ"`
+	State      string `json:"st"`
+	Nonce      string `json:"n"`
+	Verifier   string `json:"v"`             // PKCE code verifier
+	LinkUserID string `json:"lnk,omitempty"` // Account to link the identity to, instead of logging in
+	ExpiresAt  int64  `json:"exp"`
+}
+
+// Signer issues and verifies HMAC-SHA256 signed tokens of the form
+// base64url(claims JSON) "." base64url(signature)
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewSigner(secret []byte, ttl time.Duration) *Signer {
+	return &Signer{secret: secret, ttl: ttl}
+}
+
+// Issue creates a session token for an account, valid for the signer's TTL
+func (s *Signer) Issue(userID, username string, now time.Time) (token string, expiresAt time.Time, err error) {
+	expiresAt = now.Add(s.ttl)
+	token, err = s.sign(Claims{Kind: kindSession, UserID: userID, Username: username, ExpiresAt: expiresAt.Unix()})
+	return token, expiresAt, err
+}
+
+// IssueReconnect creates a token that lets its holder reclaim playerID's seat
+// in a game, valid for the signer's TTL
+func (s *Signer) IssueReconnect(gameID, playerID string, now time.Time) (string, error) {
+	return s.sign(ReconnectClaims{Kind: kindReconnect, GameID: gameID, PlayerID: playerID, ExpiresAt: now.Add(s.ttl).Unix()})
+}
+
+// Verify checks a session token's signature and expiry
+func (s *Signer) Verify(token string, now time.Time) (Claims, error) {
+	var claims Claims
+	if err := s.verify(token, &claims); err != nil {
+		return Claims{}, err
+	}
+	if claims.Kind != kindSession || claims.UserID == "" {
+		return Claims{}, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+// VerifyReconnect checks a reconnect token's signature and expiry
+func (s *Signer) VerifyReconnect(token string, now time.Time) (ReconnectClaims, error) {
+	var claims ReconnectClaims
+	if err := s.verify(token, &claims); err != nil {
+		return ReconnectClaims{}, err
+	}
+	if claims.Kind != kindReconnect || claims.GameID == "" || claims.PlayerID == "" {
+		return ReconnectClaims{}, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return ReconnectClaims{}, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+// IssueOIDCFlow signs the state of an OpenID Connect login, valid for the
+// signer's TTL
+func (s *Signer) IssueOIDCFlow(flow OIDCFlowClaims, now time.Time) (string, error) {
+	flow.Kind = kindOIDCFlow
+	flow.ExpiresAt = now.Add(s.ttl).Unix()
+	return s.sign(flow)
+}
+
+// VerifyOIDCFlow checks an OpenID Connect login state's signature and expiry
+func (s *Signer) VerifyOIDCFlow(token string, now time.Time) (OIDCFlowClaims, error) {
+	var claims OIDCFlowClaims
+	if err := s.verify(token, &claims); err != nil {
+		return OIDCFlowClaims{}, err
+	}
+	if claims.Kind != kindOIDCFlow || claims.State == "" {
+		return OIDCFlowClaims{}, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return OIDCFlowClaims{}, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func (s *Signer) sign(claims interface{}) (string, error) {
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(body)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload)), nil
+}
+
+func (s *Signer) verify(token string, claims interface{}) error {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, s.mac(payload)) {
+		return ErrInvalidToken
+	}
+	body, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(body, claims); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var tokenStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// tokenKind issues and verifies one kind of token
+type tokenKind struct {
+	name   string
+	issue  func(s *Signer, now time.Time) (string, error)
+	verify func(s *Signer, token string, now time.Time) error
+}
+
+var tokenKinds = []tokenKind{
+	{
+		name: "session",
+		issue: func(s *Signer, now time.Time) (string, error) {
+			token, _, err := s.Issue("u1", "alice", now)
+			return token, err
+		},
+		verify: func(s *Signer, token string, now time.Time) error {
+			_, err := s.Verify(token, now)
+			return err
+		},
+	},
+	{
+		name: "reconnect",
+		issue: func(s *Signer, now time.Time) (string, error) {
+			return s.IssueReconnect("g1", "p1", now)
+		},
+		verify: func(s *Signer, token string, now time.Time) error {
+			_, err := s.VerifyReconnect(token, now)
+			return err
+		},
+	},
+	{
+		name: "oidc",
+		issue: func(s *Signer, now time.Time) (string, error) {
+			return s.IssueOIDCFlow(OIDCFlowClaims{State: "state", Nonce: "nonce", Verifier: "verifier"}, now)
+		},
+		verify: func(s *Signer, token string, now time.Time) error {
+			_, err := s.VerifyOIDCFlow(token, now)
+			return err
+		},
+	},
+}
+
+func TestTokensVerify(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Hour)
+	for _, kind := range tokenKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			token, err := kind.issue(s, tokenStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := kind.verify(s, token, tokenStart.Add(time.Hour-time.Second)); err != nil {
+				t.Errorf("valid token refused: %v", err)
+			}
+		})
+	}
+}
+
+func TestTokensRejected(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Hour)
+	other := NewSigner([]byte("other secret"), time.Hour)
+
+	for _, kind := range tokenKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			token, err := kind.issue(s, tokenStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload, sig, _ := strings.Cut(token, ".")
+
+			if err := kind.verify(s, token, tokenStart.Add(time.Hour)); !errors.Is(err, ErrExpiredToken) {
+				t.Errorf("expired token: got %v, want %v", err, ErrExpiredToken)
+			}
+
+			rejected := map[string]string{
+				"tampered signature": payload + "." + flipFirst(sig),
+				"tampered claims":    flipFirst(payload) + "." + sig,
+				"forged claims":      base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"`+kind.name+`","exp":9999999999}`)) + "." + sig,
+				"no signature":       payload,
+				"empty":              "",
+			}
+			for name, bad := range rejected {
+				if err := kind.verify(s, bad, tokenStart); !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("%s: got %v, want %v", name, err, ErrInvalidToken)
+				}
+			}
+
+			if err := kind.verify(other, token, tokenStart); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("wrong secret: got %v, want %v", err, ErrInvalidToken)
+			}
+
+			for _, wrong := range tokenKinds {
+				if wrong.name == kind.name {
+					continue
+				}
+				if err := wrong.verify(s, token, tokenStart); !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("verified as %s: got %v, want %v", wrong.name, err, ErrInvalidToken)
+				}
+			}
+		})
+	}
+}
+
+// flipFirst changes the first character of a base64url string. The last
+// one may only carry padding bits, which decoding ignores.
+func flipFirst(s string) string {
+	replacement := "A"
+	if s[0] == 'A' {
+		replacement = "B"
+	}
+	return replacement + s[1:]
+}
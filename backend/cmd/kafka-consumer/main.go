@@ -27,7 +27,8 @@ func main() {
 	cfg := config.Load()
 
 	// Initialize Database
-	if err := db.InitDB(); err != nil {
+	store, err := db.Open(cfg.DatabaseURL)
+	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	log.Println("Analytics consumer connected to database")
@@ -64,15 +65,15 @@ func main() {
 			event.GameID, event.Winner, event.Duration)
 
 		// Process analytics
-		if err := processGameEvent(event); err != nil {
+		if err := processGameEvent(store, event); err != nil {
 			log.Printf("Error processing analytics: %v", err)
 		}
 	}
 }
 
-func processGameEvent(event GameEvent) error {
+func processGameEvent(store db.Store, event GameEvent) error {
 	// Update game metrics (hourly aggregation)
-	if err := db.UpdateGameMetrics(event.Duration, event.Timestamp); err != nil {
+	if err := store.UpdateGameMetrics(event.Duration, event.Timestamp); err != nil {
 		log.Printf("Failed to update game metrics: %v", err)
 	}
 
@@ -80,22 +81,22 @@ func processGameEvent(event GameEvent) error {
 	isDraw := event.Winner == "draw"
 
 	// Get player names from the game result
-	var gameResult db.GameResult
-	if err := db.DB.Where("game_id = ?", event.GameID).First(&gameResult).Error; err != nil {
+	gameResult, err := store.GetGameResult(event.GameID)
+	if err != nil {
 		log.Printf("Failed to fetch game result: %v", err)
 		return err
 	}
 
 	// Update player 1 stats
 	player1Won := !isDraw && event.Winner == gameResult.Player1.Username
-	if err := db.UpdatePlayerStats(gameResult.Player1.Username, player1Won, isDraw, event.Duration); err != nil {
+	if err := store.UpdatePlayerStats(gameResult.Player1, player1Won, isDraw, event.Duration); err != nil {
 		log.Printf("Failed to update player 1 stats: %v", err)
 	}
 
 	// Update player 2 stats (skip if bot)
 	if gameResult.Player2.Type != "bot" {
 		player2Won := !isDraw && event.Winner == gameResult.Player2.Username
-		if err := db.UpdatePlayerStats(gameResult.Player2.Username, player2Won, isDraw, event.Duration); err != nil {
+		if err := store.UpdatePlayerStats(gameResult.Player2, player2Won, isDraw, event.Duration); err != nil {
 			log.Printf("Failed to update player 2 stats: %v", err)
 		}
 	}
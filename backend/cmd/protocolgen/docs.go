@@ -0,0 +1,66 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// docs holds the doc comments of the game package's types and struct fields,
+// keyed by "Type" and "Type.Field"
+type docs map[string]string
+
+func loadDocs(dir string) (docs, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	d := make(docs)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					doc := ts.Doc
+					if doc == nil && len(gen.Specs) == 1 {
+						doc = gen.Doc
+					}
+					d.add(ts.Name.Name, doc)
+
+					st, ok := ts.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, field := range st.Fields.List {
+						for _, name := range field.Names {
+							key := ts.Name.Name + "." + name.Name
+							d.add(key, field.Doc)
+							d.add(key, field.Comment)
+						}
+					}
+				}
+			}
+		}
+	}
+	return d, nil
+}
+
+func (d docs) add(key string, group *ast.CommentGroup) {
+	if group == nil || d[key] != "" {
+		return
+	}
+	text := strings.Join(strings.Fields(group.Text()), " ")
+	if text != "" {
+		d[key] = text
+	}
+}
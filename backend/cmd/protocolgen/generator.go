@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"4-in-a-row/game"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// field is a struct field as it appears on the wire
+type field struct {
+	Name     string // JSON name
+	Type     reflect.Type
+	Optional bool // omitempty
+	Doc      string
+}
+
+// generator turns the message catalog into a spec and TypeScript types. The
+// payload structs are collected in the order they are first referenced.
+type generator struct {
+	docs    docs
+	structs []reflect.Type
+	seen    map[reflect.Type]bool
+	schemas map[string]interface{}
+}
+
+func newGenerator(d docs) *generator {
+	g := &generator{
+		docs:    d,
+		seen:    make(map[reflect.Type]bool),
+		schemas: make(map[string]interface{}),
+	}
+	for _, m := range game.Messages {
+		if m.Payload != nil {
+			g.schema(reflect.TypeOf(m.Payload))
+		}
+	}
+	return g
+}
+
+// fields lists the JSON fields of a struct type
+func (g *generator) fields(t reflect.Type) []field {
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, field{
+			Name:     name,
+			Type:     f.Type,
+			Optional: strings.Contains(opts, "omitempty"),
+			Doc:      g.docs[t.Name()+"."+f.Name],
+		})
+	}
+	return fields
+}
+
+// schema returns the JSON Schema for t, registering named structs as
+// components
+func (g *generator) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Struct:
+		g.register(t)
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Array:
+		return map[string]interface{}{
+			"type":     "array",
+			"items":    g.schema(t.Elem()),
+			"minItems": t.Len(),
+			"maxItems": t.Len(),
+		}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *generator) register(t reflect.Type) {
+	if g.seen[t] {
+		return
+	}
+	g.seen[t] = true
+	g.structs = append(g.structs, t)
+
+	properties := make(map[string]interface{})
+	required := make([]string, 0)
+	for _, f := range g.fields(t) {
+		s := g.schema(f.Type)
+		if f.Doc != "" && s["$ref"] == nil {
+			s["description"] = f.Doc
+		}
+		properties[f.Name] = s
+		if !f.Optional {
+			required = append(required, f.Name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+	if doc := g.docs[t.Name()]; doc != "" {
+		schema["description"] = doc
+	}
+	g.schemas[t.Name()] = schema
+}
+
+// payloadSchema is the schema of a message's payload field
+func (g *generator) payloadSchema(m game.MessageSpec) map[string]interface{} {
+	if m.Payload == nil {
+		return map[string]interface{}{"type": "null"}
+	}
+	s := g.schema(reflect.TypeOf(m.Payload))
+	if m.Legacy {
+		return map[string]interface{}{
+			"oneOf":       []interface{}{s, map[string]interface{}{"type": "string"}},
+			"description": "Legacy clients use a bare string",
+		}
+	}
+	return s
+}
+
+// asyncAPI renders the AsyncAPI document
+func (g *generator) asyncAPI() ([]byte, error) {
+	messages := make(map[string]interface{})
+	var publish, subscribe []interface{}
+
+	for _, m := range game.Messages {
+		key := m.Direction + "." + m.Type
+		properties := map[string]interface{}{
+			"type":    map[string]interface{}{"const": m.Type},
+			"payload": g.payloadSchema(m),
+		}
+		required := []string{"type"}
+
+		ref := map[string]interface{}{"$ref": "#/components/messages/" + key}
+		if m.Direction == game.FromClient {
+			properties["id"] = map[string]interface{}{
+				"type":        "string",
+				"description": "Optional request ID, answered with ACK or NACK",
+			}
+			if m.Payload != nil {
+				required = append(required, "payload")
+			}
+			publish = append(publish, ref)
+		} else {
+			properties["seq"] = map[string]interface{}{
+				"type":        "integer",
+				"description": "Per-session sequence number, used to resume with RECONNECT",
+			}
+			required = append(required, "payload")
+			subscribe = append(subscribe, ref)
+		}
+
+		messages[key] = map[string]interface{}{
+			"name":    m.Type,
+			"title":   m.Type,
+			"summary": m.Summary,
+			"payload": map[string]interface{}{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			},
+		}
+	}
+
+	doc := map[string]interface{}{
+		"asyncapi": "2.6.0",
+		"info": map[string]interface{}{
+			"title":   "Four in a Row WebSocket protocol",
+			"version": strconv.Itoa(game.ProtocolVersion),
+			"description": "Generated by cmd/protocolgen from the game package; do not edit. " +
+				"Messages are JSON text frames, or MessagePack binary frames on the " +
+				game.SubprotocolMsgpack + " subprotocol.",
+		},
+		"defaultContentType": "application/json",
+		"channels": map[string]interface{}{
+			"/ws": map[string]interface{}{
+				"publish": map[string]interface{}{
+					"summary": "Messages sent by the client",
+					"message": map[string]interface{}{"oneOf": publish},
+				},
+				"subscribe": map[string]interface{}{
+					"summary": "Messages sent by the server",
+					"message": map[string]interface{}{"oneOf": subscribe},
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"messages": messages,
+			"schemas":  g.schemas,
+		},
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,60 @@
+// Command protocolgen generates the WebSocket protocol spec (AsyncAPI with
+// JSON Schema payloads) and matching TypeScript types from game.Messages.
+// With -check it fails instead of writing when the checked-in files differ.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func main() {
+	src := flag.String("src", "game", "directory of the game package, read for doc comments")
+	specPath := flag.String("spec", "protocol/asyncapi.json", "AsyncAPI document to write")
+	tsPath := flag.String("ts", "../frontend/lib/protocol.ts", "TypeScript types to write")
+	check := flag.Bool("check", false, "fail if the files are out of date instead of writing them")
+	flag.Parse()
+
+	docs, err := loadDocs(*src)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *src, err)
+	}
+
+	g := newGenerator(docs)
+	spec, err := g.asyncAPI()
+	if err != nil {
+		log.Fatalf("Failed to build spec: %v", err)
+	}
+	ts := g.typeScript()
+
+	outputs := []struct {
+		path string
+		data []byte
+	}{
+		{*specPath, spec},
+		{*tsPath, ts},
+	}
+
+	stale := false
+	for _, out := range outputs {
+		if *check {
+			current, err := os.ReadFile(out.path)
+			if err != nil || !bytes.Equal(current, out.data) {
+				fmt.Fprintf(os.Stderr, "%s is out of date with game/messages; run `make protocol`\n", out.path)
+				stale = true
+			}
+			continue
+		}
+		if err := os.WriteFile(out.path, out.data, 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", out.path, err)
+		}
+		log.Printf("Wrote %s", out.path)
+	}
+
+	if stale {
+		os.Exit(1)
+	}
+}
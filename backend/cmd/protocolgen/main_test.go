@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestGeneratedFilesUpToDate fails when the checked-in spec or TypeScript
+// types no longer match game.Messages
+func TestGeneratedFilesUpToDate(t *testing.T) {
+	docs, err := loadDocs("../../game")
+	if err != nil {
+		t.Fatalf("read game package: %v", err)
+	}
+
+	g := newGenerator(docs)
+	spec, err := g.asyncAPI()
+	if err != nil {
+		t.Fatalf("build spec: %v", err)
+	}
+
+	for path, want := range map[string][]byte{
+		"../../protocol/asyncapi.json":      spec,
+		"../../../frontend/lib/protocol.ts": g.typeScript(),
+	} {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date with game/messages; run `make protocol`", path)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"4-in-a-row/game"
+)
+
+// typeScript renders the payload structs as interfaces and the messages as
+// discriminated unions on "type"
+func (g *generator) typeScript() []byte {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by cmd/protocolgen from backend/game; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "export const PROTOCOL_VERSION = %d;\n", game.ProtocolVersion)
+
+	for _, t := range g.structs {
+		b.WriteString("\n")
+		writeDoc(&b, "", g.docs[t.Name()])
+		fmt.Fprintf(&b, "export interface %s {\n", t.Name())
+		for _, f := range g.fields(t) {
+			writeDoc(&b, "  ", f.Doc)
+			optional := ""
+			if f.Optional {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", f.Name, optional, tsFieldType(f))
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, direction := range []string{game.FromClient, game.FromServer} {
+		name := "ClientMessage"
+		if direction == game.FromServer {
+			name = "ServerMessage"
+		}
+		fmt.Fprintf(&b, "\nexport type %s =\n", name)
+		for _, m := range game.Messages {
+			if m.Direction != direction {
+				continue
+			}
+			fmt.Fprintf(&b, "  | %s\n", tsMessage(m))
+		}
+		b.Truncate(b.Len() - 1)
+		b.WriteString(";\n")
+	}
+
+	return b.Bytes()
+}
+
+func tsMessage(m game.MessageSpec) string {
+	payload := "payload?: null"
+	if m.Payload != nil {
+		payloadType := tsType(reflect.TypeOf(m.Payload))
+		if m.Legacy {
+			payloadType += " | string"
+		}
+		payload = "payload: " + payloadType
+	}
+
+	if m.Direction == game.FromClient {
+		return fmt.Sprintf("{ id?: string; type: '%s'; %s }", m.Type, payload)
+	}
+	return fmt.Sprintf("{ type: '%s'; %s; seq?: number }", m.Type, payload)
+}
+
+// tsFieldType is a field's type; pointers without omitempty may be null
+func tsFieldType(f field) string {
+	if f.Type.Kind() == reflect.Ptr && !f.Optional {
+		return tsType(f.Type) + " | null"
+	}
+	return tsType(f.Type)
+}
+
+func tsType(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "string"
+	case t == rawType:
+		return "unknown"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return tsType(t.Elem())
+	case reflect.Struct:
+		return t.Name()
+	case reflect.Slice, reflect.Array:
+		return tsType(t.Elem()) + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("Record<string, %s>", tsType(t.Elem()))
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return "unknown"
+}
+
+func writeDoc(b *bytes.Buffer, indent, doc string) {
+	if doc != "" {
+		fmt.Fprintf(b, "%s/** %s */\n", indent, doc)
+	}
+}
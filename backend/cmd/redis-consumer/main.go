@@ -23,7 +23,8 @@ func main() {
 	cfg := config.Load()
 
 	// Initialize database
-	if err := db.InitDB(); err != nil {
+	store, err := db.Open(cfg.DatabaseURL)
+	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
@@ -98,7 +99,7 @@ func main() {
 			// Process messages
 			for _, stream := range streams {
 				for _, message := range stream.Messages {
-					processMessage(ctx, client, streamName, groupName, message)
+					processMessage(ctx, client, store, streamName, groupName, message)
 				}
 			}
 		}
@@ -109,7 +110,7 @@ func main() {
 	log.Println("Shutting down Redis consumer...")
 }
 
-func processMessage(ctx context.Context, client *redis.Client, streamName, groupName string, msg redis.XMessage) {
+func processMessage(ctx context.Context, client *redis.Client, store db.Store, streamName, groupName string, msg redis.XMessage) {
 	// Parse event from fields
 	event := analytics.GameEvent{
 		Event:  getStringField(msg.Values, "event"),
@@ -132,7 +133,7 @@ func processMessage(ctx context.Context, client *redis.Client, streamName, group
 	}
 
 	// Process the event
-	processGameEvent(event)
+	processGameEvent(store, event)
 
 	// Acknowledge message
 	client.XAck(ctx, streamName, groupName, msg.ID)
@@ -145,12 +146,12 @@ func getStringField(values map[string]interface{}, key string) string {
 	return ""
 }
 
-func processGameEvent(event analytics.GameEvent) {
+func processGameEvent(store db.Store, event analytics.GameEvent) {
 	log.Printf("Processing event: %s for game %s", event.Event, event.GameID)
 
 	if event.Event == "GAME_END" {
 		// Update game metrics (hourly aggregation)
-		if err := db.UpdateGameMetrics(event.Duration, event.Timestamp); err != nil {
+		if err := store.UpdateGameMetrics(event.Duration, event.Timestamp); err != nil {
 			log.Printf("Failed to update game metrics: %v", err)
 		}
 
@@ -158,22 +159,22 @@ func processGameEvent(event analytics.GameEvent) {
 		isDraw := event.Winner == "draw"
 
 		// Get player names from the game result
-		var gameResult db.GameResult
-		if err := db.DB.Where("game_id = ?", event.GameID).First(&gameResult).Error; err != nil {
+		gameResult, err := store.GetGameResult(event.GameID)
+		if err != nil {
 			log.Printf("Failed to fetch game result: %v", err)
 			return
 		}
 
 		// Update player 1 stats
 		player1Won := !isDraw && event.Winner == gameResult.Player1.Username
-		if err := db.UpdatePlayerStats(gameResult.Player1.Username, player1Won, isDraw, event.Duration); err != nil {
+		if err := store.UpdatePlayerStats(gameResult.Player1, player1Won, isDraw, event.Duration); err != nil {
 			log.Printf("Failed to update player 1 stats: %v", err)
 		}
 
 		// Update player 2 stats (skip if bot)
 		if gameResult.Player2.Type != "bot" {
 			player2Won := !isDraw && event.Winner == gameResult.Player2.Username
-			if err := db.UpdatePlayerStats(gameResult.Player2.Username, player2Won, isDraw, event.Duration); err != nil {
+			if err := store.UpdatePlayerStats(gameResult.Player2, player2Won, isDraw, event.Duration); err != nil {
 				log.Printf("Failed to update player 2 stats: %v", err)
 			}
 		}
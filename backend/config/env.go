@@ -1,9 +1,12 @@
 package config
 
 import (
+	"crypto/rand"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -18,15 +21,47 @@ type Config struct {
 	RedisStream         string
 	KafkaBrokers        string
 	KafkaTopic          string
-}
 
-var globalConfig *Config
+	// Clients on the legacy protocol (no HELLO) are rejected from this time on; zero keeps them working
+	LegacyProtocolSunset time.Time
 
-func Load() *Config {
-	if globalConfig != nil {
-		return globalConfig
-	}
+	// Inbound WebSocket limits
+	WSMaxMessageBytes int64   // Largest message a client may send
+	WSMessageRate     float64 // Messages per second allowed on one connection
+	WSMessageBurst    int
+	WSIPMessageRate   float64 // Messages per second allowed across all connections from one IP
+	WSIPMessageBurst  int
+	WSMaxConnsPerIP   int
+	TrustProxyHeaders bool // Take the client IP from X-Forwarded-For
+	TrustedProxyHops  int  // Proxies in front of the server that append to X-Forwarded-For
+
+	// Accounts
+	AuthSecret   []byte        // Signs session tokens
+	SessionTTL   time.Duration // How long a login stays valid
+	AllowGuests  bool          // Let clients without a session token play under any free username
+	AdminUserIDs []string      // IDs of accounts given the admin role at startup
 
+	// How often the ban list is reloaded from the database, so bans made on
+	// other instances take effect
+	BanRefreshInterval time.Duration
+
+	// OpenID Connect login; disabled while OIDCIssuer is empty
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string   // This server's /auth/oidc/callback as registered with the provider
+	OIDCScopes       []string // Defaults to openid, profile and email
+	OIDCSuccessURL   string   // Frontend page to return to; the session token follows in the URL fragment
+	OIDCMockAddr     string   // Serve the built-in mock provider on this address (local only)
+
+	// Words no username may contain, on top of the built-in list
+	UsernameBlocklist []string
+	// Words that may contain a blocked word, on top of the built-in list
+	UsernameAllowlist []string
+}
+
+// Load reads the configuration from the environment (and .env if present)
+func Load() *Config {
 	godotenv.Load()
 
 	resourceEnv := strings.ToLower(os.Getenv("RESOURCE_ENVIRONMENT"))
@@ -64,24 +99,123 @@ func Load() *Config {
 	config.KafkaBrokers = getEnv("KAFKA_BROKERS_LOCAL", "localhost:9092")
 	config.KafkaTopic = getEnv("KAFKA_TOPIC_LOCAL", "game-analytics")
 
+	if sunset := os.Getenv("PROTOCOL_LEGACY_SUNSET"); sunset != "" {
+		t, err := time.Parse("2006-01-02", sunset)
+		if err != nil {
+			log.Fatalf("Invalid PROTOCOL_LEGACY_SUNSET %q: expected YYYY-MM-DD", sunset)
+		}
+		config.LegacyProtocolSunset = t
+	}
+
+	config.WSMaxMessageBytes = int64(getEnvInt("WS_MAX_MESSAGE_BYTES", 4096))
+	config.WSMessageRate = getEnvFloat("WS_MESSAGE_RATE", 10)
+	config.WSMessageBurst = getEnvInt("WS_MESSAGE_BURST", 20)
+	config.WSIPMessageRate = getEnvFloat("WS_IP_MESSAGE_RATE", 30)
+	config.WSIPMessageBurst = getEnvInt("WS_IP_MESSAGE_BURST", 60)
+	config.WSMaxConnsPerIP = getEnvInt("WS_MAX_CONNS_PER_IP", 10)
+	config.TrustProxyHeaders = getEnv("TRUST_PROXY_HEADERS", "false") == "true"
+	config.TrustedProxyHops = getEnvInt("TRUSTED_PROXY_HOPS", 1)
+
+	if secret := os.Getenv("AUTH_SECRET"); secret != "" {
+		config.AuthSecret = []byte(secret)
+	} else if resourceEnv == "cloud" {
+		log.Fatal("AUTH_SECRET not set for cloud environment")
+	} else {
+		// Sessions will not survive a restart, which is fine for local development
+		config.AuthSecret = make([]byte, 32)
+		if _, err := rand.Read(config.AuthSecret); err != nil {
+			log.Fatalf("Failed to generate AUTH_SECRET: %v", err)
+		}
+		log.Println("AUTH_SECRET not set; using a random secret for this run")
+	}
+	config.SessionTTL = getEnvDuration("SESSION_TTL", 7*24*time.Hour)
+	config.AllowGuests = getEnv("ALLOW_GUESTS", "true") == "true"
+	config.AdminUserIDs = getEnvList("ADMIN_USER_IDS")
+	config.BanRefreshInterval = getEnvDuration("BAN_REFRESH_INTERVAL", 30*time.Second)
+
+	config.OIDCMockAddr = os.Getenv("OIDC_MOCK_ADDR")
+	if config.OIDCMockAddr != "" && resourceEnv == "cloud" {
+		log.Fatal("OIDC_MOCK_ADDR must not be set for cloud environment")
+	}
+	defaultIssuer := ""
+	if config.OIDCMockAddr != "" {
+		_, port, _ := strings.Cut(config.OIDCMockAddr, ":")
+		defaultIssuer = "http://localhost:" + port
+	}
+	config.OIDCIssuer = getEnv("OIDC_ISSUER", defaultIssuer)
+	config.OIDCClientID = getEnv("OIDC_CLIENT_ID", "four-in-a-row")
+	config.OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	config.OIDCRedirectURL = getEnv("OIDC_REDIRECT_URL", "http://localhost:"+config.Port+"/auth/oidc/callback")
+	config.OIDCScopes = strings.Fields(os.Getenv("OIDC_SCOPES"))
+	config.OIDCSuccessURL = os.Getenv("OIDC_SUCCESS_URL")
+
+	config.UsernameBlocklist = getEnvList("USERNAME_BLOCKLIST")
+	if path := os.Getenv("USERNAME_BLOCKLIST_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Failed to read USERNAME_BLOCKLIST_FILE: %v", err)
+		}
+		config.UsernameBlocklist = append(config.UsernameBlocklist, strings.Fields(string(data))...)
+	}
+	config.UsernameAllowlist = getEnvList("USERNAME_ALLOWLIST")
+
 	log.Printf("Configuration loaded: environment=%s, event_stream=%s",
 		config.ResourceEnvironment, config.EventStream)
 
-	globalConfig = config
 	return config
 }
 
-func Get() *Config {
-	if globalConfig == nil {
-		return Load()
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
-	return globalConfig
+	return value
 }
 
-func getEnv(key, defaultValue string) string {
+// getEnvList splits a comma-separated variable, dropping empty entries
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvInt(key string, defaultValue int) int {
 	value := os.Getenv(key)
 	if value == "" {
 		return defaultValue
 	}
-	return value
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: expected an integer", key, value)
+	}
+	return n
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: expected a duration such as 24h", key, value)
+	}
+	return d
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: expected a number", key, value)
+	}
+	return f
 }
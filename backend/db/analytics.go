@@ -4,10 +4,12 @@ import (
 	"time"
 )
 
-// PlayerStats tracks user-specific metrics
+// PlayerStats tracks user-specific metrics. Registered players are keyed by
+// UserID; guests (empty UserID) by username.
 type PlayerStats struct {
 	ID            uint   `gorm:"primaryKey"`
-	Username      string `gorm:"uniqueIndex"`
+	UserID        string `gorm:"index"`
+	Username      string `gorm:"index:idx_player_stats_name"`
 	TotalGames    int
 	Wins          int
 	Losses        int
@@ -29,63 +31,98 @@ type GameMetrics struct {
 }
 
 // UpdatePlayerStats updates player statistics for a completed game
-func UpdatePlayerStats(username string, won bool, isDraw bool, duration int64) error {
-	if DB == nil {
-		return &ConfigError{"Database not initialized"}
-	}
-
+func (s *GormStore) UpdatePlayerStats(player PlayerData, won bool, isDraw bool, duration int64) error {
 	var stats PlayerStats
 
-	result := DB.Where(PlayerStats{Username: username}).FirstOrCreate(&stats)
+	query := s.DB.Where("user_id = ?", player.UserID)
+	if player.UserID == "" {
+		query = query.Where("username = ?", player.Username)
+	}
+	result := query.Attrs(PlayerStats{UserID: player.UserID, Username: player.Username}).FirstOrCreate(&stats)
 	if result.Error != nil {
 		return result.Error
 	}
 
-	stats.TotalGames++
-	stats.TotalDuration += duration
-	stats.LastPlayed = time.Now()
-
-	if isDraw {
-		stats.Draws++
-	} else if won {
-		stats.Wins++
-	} else {
-		stats.Losses++
-	}
+	stats.Username = player.Username
+	applyGameToStats(&stats, won, isDraw, duration)
 
-	return DB.Save(&stats).Error
+	return s.DB.Save(&stats).Error
 }
 
 // UpdateGameMetrics aggregates game metrics by hour
-func UpdateGameMetrics(duration int64, timestamp time.Time) error {
-	if DB == nil {
-		return &ConfigError{"Database not initialized"}
-	}
-
+func (s *GormStore) UpdateGameMetrics(duration int64, timestamp time.Time) error {
 	date := time.Date(timestamp.Year(), timestamp.Month(), timestamp.Day(), 0, 0, 0, 0, timestamp.Location())
 	hour := timestamp.Hour()
 
 	var metrics GameMetrics
 
-	result := DB.Where(GameMetrics{Date: date, Hour: hour}).FirstOrCreate(&metrics)
+	result := s.DB.Where(GameMetrics{Date: date, Hour: hour}).FirstOrCreate(&metrics)
 	if result.Error != nil {
 		return result.Error
 	}
 
-	metrics.GamesPlayed++
-	metrics.TotalDuration += duration
-	metrics.AverageDuration = float64(metrics.TotalDuration) / float64(metrics.GamesPlayed)
+	applyGameToMetrics(&metrics, duration)
 
-	return DB.Save(&metrics).Error
+	return s.DB.Save(&metrics).Error
 }
 
 // GetTopPlayers returns top N players by wins
-func GetTopPlayers(limit int) ([]PlayerStats, error) {
-	if DB == nil {
-		return nil, &ConfigError{"Database not initialized"}
-	}
-
+func (s *GormStore) GetTopPlayers(limit int) ([]PlayerStats, error) {
 	var players []PlayerStats
-	err := DB.Order("wins DESC").Limit(limit).Find(&players).Error
+	err := s.DB.Order("wins DESC").Limit(limit).Find(&players).Error
 	return players, err
 }
+
+// GetGameSummary returns overall game totals; games since today count as today's
+func (s *GormStore) GetGameSummary(today time.Time) (*GameSummary, error) {
+	var summary GameSummary
+
+	if err := s.DB.Model(&GameResult{}).Count(&summary.TotalGames).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.Model(&PlayerStats{}).Count(&summary.TotalPlayers).Error; err != nil {
+		return nil, err
+	}
+
+	// Use COALESCE to handle NULL when no games exist
+	if err := s.DB.Model(&GameResult{}).Select("COALESCE(AVG(duration), 0)").Scan(&summary.AverageDuration).Error; err != nil {
+		return nil, err
+	}
+
+	if err := s.DB.Model(&GameResult{}).Where("created_at >= ?", today).Count(&summary.GamesToday).Error; err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
+
+// RecentMetrics returns hourly metrics from the given day onwards, newest first
+func (s *GormStore) RecentMetrics(since time.Time, limit int) ([]GameMetrics, error) {
+	var metrics []GameMetrics
+	err := s.DB.Where("date >= ?", since).
+		Order("date DESC, hour DESC").
+		Limit(limit).
+		Find(&metrics).Error
+	return metrics, err
+}
+
+func applyGameToStats(stats *PlayerStats, won bool, isDraw bool, duration int64) {
+	stats.TotalGames++
+	stats.TotalDuration += duration
+	stats.LastPlayed = time.Now()
+
+	if isDraw {
+		stats.Draws++
+	} else if won {
+		stats.Wins++
+	} else {
+		stats.Losses++
+	}
+}
+
+func applyGameToMetrics(metrics *GameMetrics, duration int64) {
+	metrics.GamesPlayed++
+	metrics.TotalDuration += duration
+	metrics.AverageDuration = float64(metrics.TotalDuration) / float64(metrics.GamesPlayed)
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"time"
+)
+
+// What a ban applies to
+const (
+	BanAccount  = "account"  // Value is a user ID
+	BanUsername = "username" // Value is a name skeleton; covers guests and lookalike names
+	BanIP       = "ip"       // Value is a CIDR range; a single address is stored as /32 or /128
+)
+
+// Ban keeps an account, a username or a range of addresses from playing
+type Ban struct {
+	ID        uint   `gorm:"primaryKey"`
+	Kind      string `gorm:"index:idx_ban_target"`
+	Value     string `gorm:"index:idx_ban_target"`
+	Label     string // Username or address as the moderator entered it
+	Reason    string
+	CreatedBy string     // Account ID of the moderator
+	ExpiresAt *time.Time `gorm:"index"` // Nil for a permanent ban
+	CreatedAt time.Time
+}
+
+// Active reports whether the ban is still in force at now
+func (b Ban) Active(now time.Time) bool {
+	return b.ExpiresAt == nil || b.ExpiresAt.After(now)
+}
+
+// CreateBan stores a ban
+func (s *GormStore) CreateBan(b *Ban) error {
+	return s.DB.Create(b).Error
+}
+
+// DeleteBan lifts a ban
+func (s *GormStore) DeleteBan(id uint) error {
+	result := s.DB.Delete(&Ban{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListBans returns the bans still in force at now, oldest first
+func (s *GormStore) ListBans(now time.Time) ([]Ban, error) {
+	var bans []Ban
+	err := s.DB.Where("expires_at IS NULL OR expires_at > ?", now).Order("created_at").Find(&bans).Error
+	return bans, err
+}
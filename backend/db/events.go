@@ -0,0 +1,50 @@
+package db
+
+import (
+	"time"
+)
+
+// GameEventData holds the details of a game event; only the fields relevant
+// to the event type are set
+type GameEventData struct {
+	Player1 *PlayerData `json:"player1,omitempty"`
+	Player2 *PlayerData `json:"player2,omitempty"`
+	Move    *MoveData   `json:"move,omitempty"`
+	Player  int         `json:"player,omitempty"` // Symbol of the player the event concerns
+	Winner  int         `json:"winner,omitempty"` // 1 = p1, 2 = p2, 3 = draw
+}
+
+// GameEvent is one entry in a game's ordered event log
+type GameEvent struct {
+	ID        uint          `gorm:"primaryKey"`
+	GameID    string        `gorm:"uniqueIndex:idx_game_event_seq"`
+	Seq       int           `gorm:"uniqueIndex:idx_game_event_seq"`
+	Type      string        `gorm:"index"`
+	Data      GameEventData `gorm:"type:jsonb;serializer:json"`
+	CreatedAt time.Time
+}
+
+// AppendGameEvent persists a single event to a game's log
+func (s *GormStore) AppendGameEvent(event GameEvent) error {
+	return s.DB.Create(&event).Error
+}
+
+// GetGameEvents returns a game's events in the order they happened
+func (s *GormStore) GetGameEvents(gameID string) ([]GameEvent, error) {
+	var events []GameEvent
+	err := s.DB.Where("game_id = ?", gameID).Order("seq ASC").Find(&events).Error
+	return events, err
+}
+
+// GetUnfinishedGameIDs returns games that were created but never finished,
+// e.g. because the server stopped while they were in progress
+func (s *GormStore) GetUnfinishedGameIDs() ([]string, error) {
+	finished := s.DB.Model(&GameEvent{}).Select("game_id").Where("type = ?", "finished")
+
+	var ids []string
+	err := s.DB.Model(&GameEvent{}).
+		Where("type = ?", "created").
+		Where("game_id NOT IN (?)", finished).
+		Pluck("game_id", &ids).Error
+	return ids, err
+}
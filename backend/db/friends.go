@@ -0,0 +1,103 @@
+package db
+
+import (
+	"errors"
+	"time"
+)
+
+// Friendship states
+const (
+	FriendPending  = "pending"
+	FriendAccepted = "accepted"
+)
+
+// ErrFriendshipExists is returned when two users already have a friendship
+// or a pending request in either direction
+var ErrFriendshipExists = errors.New("friendship already exists")
+
+// Friendship links two accounts. It starts pending when RequesterID asks
+// and becomes accepted once AddresseeID agrees.
+type Friendship struct {
+	ID          uint   `gorm:"primaryKey"`
+	RequesterID string `gorm:"uniqueIndex:idx_friendship_pair;index"`
+	AddresseeID string `gorm:"uniqueIndex:idx_friendship_pair;index"`
+	Status      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Other returns the user on the other side of the friendship from userID
+func (f Friendship) Other(userID string) string {
+	if f.RequesterID == userID {
+		return f.AddresseeID
+	}
+	return f.RequesterID
+}
+
+// CreateFriendship stores a new friend request
+func (s *GormStore) CreateFriendship(f *Friendship) error {
+	var count int64
+	err := s.DB.Model(&Friendship{}).
+		Where("(requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?)",
+			f.RequesterID, f.AddresseeID, f.AddresseeID, f.RequesterID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrFriendshipExists
+	}
+	return s.DB.Create(f).Error
+}
+
+// GetFriendship returns the friendship between two users, whichever of them asked
+func (s *GormStore) GetFriendship(userID, otherID string) (*Friendship, error) {
+	var f Friendship
+	err := s.DB.
+		Where("(requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?)",
+			userID, otherID, otherID, userID).
+		First(&f).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &f, nil
+}
+
+// AcceptFriendship accepts requesterID's pending request to addresseeID
+func (s *GormStore) AcceptFriendship(requesterID, addresseeID string) error {
+	result := s.DB.Model(&Friendship{}).
+		Where("requester_id = ? AND addressee_id = ? AND status = ?", requesterID, addresseeID, FriendPending).
+		Updates(map[string]interface{}{"status": FriendAccepted, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteFriendship removes a friendship or request between two users
+func (s *GormStore) DeleteFriendship(userID, otherID string) error {
+	result := s.DB.
+		Where("(requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?)",
+			userID, otherID, otherID, userID).
+		Delete(&Friendship{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListFriendships returns every friendship and request userID is part of
+func (s *GormStore) ListFriendships(userID string) ([]Friendship, error) {
+	var friendships []Friendship
+	err := s.DB.
+		Where("requester_id = ? OR addressee_id = ?", userID, userID).
+		Order("created_at").
+		Find(&friendships).Error
+	return friendships, err
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrIdentityLinked is returned when an external identity already belongs
+// to an account
+var ErrIdentityLinked = errors.New("identity already linked")
+
+// Identity links an account to a user of an OpenID Connect provider. The
+// issuer and subject together identify the provider's user.
+type Identity struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    string `gorm:"index"`
+	Issuer    string `gorm:"uniqueIndex:idx_identity"`
+	Subject   string `gorm:"uniqueIndex:idx_identity"`
+	Email     string // As the provider last reported it
+	CreatedAt time.Time
+}
+
+// CreateIdentity links an external identity to an account
+func (s *GormStore) CreateIdentity(identity *Identity) error {
+	var count int64
+	err := s.DB.Model(&Identity{}).
+		Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrIdentityLinked
+	}
+	return s.DB.Create(identity).Error
+}
+
+// CreateUserWithIdentity registers a new account linked to an external
+// identity. Both are created or neither is, so a failed link leaves no
+// account behind.
+func (s *GormStore) CreateUserWithIdentity(user *User, identity *Identity) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		txStore := &GormStore{DB: tx}
+		if err := txStore.CreateUser(user); err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return txStore.CreateIdentity(identity)
+	})
+}
+
+// GetIdentity looks up the account link of an external identity
+func (s *GormStore) GetIdentity(issuer, subject string) (*Identity, error) {
+	var identity Identity
+	if err := s.DB.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &identity, nil
+}
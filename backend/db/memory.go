@@ -0,0 +1,682 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"4-in-a-row/names"
+)
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// MemoryStore is an in-process Store for tests and running without a database
+type MemoryStore struct {
+	mu      sync.RWMutex
+	results []GameResult
+	stats   map[string]*PlayerStats
+	metrics []*GameMetrics
+	events  map[string][]GameEvent
+	gameIDs []string // Games in the order they were created
+	users   map[string]*User
+	idents  []Identity
+	friends []*Friendship
+	blocks  []Block
+	reports []*Report
+	bans    []Ban
+	banID   uint // Last ban ID handed out
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		stats:  make(map[string]*PlayerStats),
+		events: make(map[string][]GameEvent),
+		users:  make(map[string]*User),
+	}
+}
+
+func (s *MemoryStore) SaveGameResult(result *GameResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = time.Now()
+	}
+	result.ID = uint(len(s.results) + 1)
+	s.results = append(s.results, *result)
+	return nil
+}
+
+func (s *MemoryStore) GetGameResult(gameID string) (*GameResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.results {
+		if r.GameID == gameID {
+			result := r
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) RecentGames(limit int) ([]GameResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	games := make([]GameResult, 0, limit)
+	for i := len(s.results) - 1; i >= 0 && len(games) < limit; i-- {
+		games = append(games, s.results[i])
+	}
+	return games, nil
+}
+
+func (s *MemoryStore) TopWinners(limit int) ([]WinnerCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, r := range s.results {
+		if r.Winner != "draw" {
+			counts[r.Winner]++
+		}
+	}
+
+	results := make([]WinnerCount, 0, len(counts))
+	for winner, wins := range counts {
+		results = append(results, WinnerCount{Winner: winner, Wins: wins})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Wins != results[j].Wins {
+			return results[i].Wins > results[j].Wins
+		}
+		return results[i].Winner < results[j].Winner
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *MemoryStore) UpdatePlayerStats(player PlayerData, won bool, isDraw bool, duration int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := "user:" + player.UserID
+	if player.UserID == "" {
+		key = "guest:" + player.Username
+	}
+	stats, ok := s.stats[key]
+	if !ok {
+		stats = &PlayerStats{ID: uint(len(s.stats) + 1), UserID: player.UserID}
+		s.stats[key] = stats
+	}
+	stats.Username = player.Username
+	applyGameToStats(stats, won, isDraw, duration)
+	stats.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) PlayerGames(k PlayerKey, limit int) ([]GameResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	games := make([]GameResult, 0)
+	for i := len(s.results) - 1; i >= 0; i-- {
+		r := s.results[i]
+		if !k.Matches(r.Player1) && !k.Matches(r.Player2) {
+			continue
+		}
+		games = append(games, r)
+		if len(games) == limit {
+			break
+		}
+	}
+	return games, nil
+}
+
+func (s *MemoryStore) HeadToHead(a, b PlayerKey) ([]GameResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	games := make([]GameResult, 0)
+	for i := len(s.results) - 1; i >= 0; i-- {
+		r := s.results[i]
+		if (a.Matches(r.Player1) && b.Matches(r.Player2)) || (b.Matches(r.Player1) && a.Matches(r.Player2)) {
+			games = append(games, r)
+		}
+	}
+	return games, nil
+}
+
+func (s *MemoryStore) UpdateGameMetrics(duration int64, timestamp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	date := time.Date(timestamp.Year(), timestamp.Month(), timestamp.Day(), 0, 0, 0, 0, timestamp.Location())
+	hour := timestamp.Hour()
+
+	var metrics *GameMetrics
+	for _, m := range s.metrics {
+		if m.Date.Equal(date) && m.Hour == hour {
+			metrics = m
+			break
+		}
+	}
+	if metrics == nil {
+		metrics = &GameMetrics{ID: uint(len(s.metrics) + 1), Date: date, Hour: hour}
+		s.metrics = append(s.metrics, metrics)
+	}
+	applyGameToMetrics(metrics, duration)
+	metrics.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) GetTopPlayers(limit int) ([]PlayerStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	players := make([]PlayerStats, 0, len(s.stats))
+	for _, p := range s.stats {
+		players = append(players, *p)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Wins > players[j].Wins
+	})
+	if len(players) > limit {
+		players = players[:limit]
+	}
+	return players, nil
+}
+
+func (s *MemoryStore) GetGameSummary(today time.Time) (*GameSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	summary := &GameSummary{
+		TotalGames:   int64(len(s.results)),
+		TotalPlayers: int64(len(s.stats)),
+	}
+
+	var totalDuration int64
+	for _, r := range s.results {
+		totalDuration += r.Duration
+		if !r.CreatedAt.Before(today) {
+			summary.GamesToday++
+		}
+	}
+	if len(s.results) > 0 {
+		summary.AverageDuration = float64(totalDuration) / float64(len(s.results))
+	}
+
+	return summary, nil
+}
+
+func (s *MemoryStore) RecentMetrics(since time.Time, limit int) ([]GameMetrics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	metrics := make([]GameMetrics, 0)
+	for _, m := range s.metrics {
+		if !m.Date.Before(since) {
+			metrics = append(metrics, *m)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if !metrics[i].Date.Equal(metrics[j].Date) {
+			return metrics[i].Date.After(metrics[j].Date)
+		}
+		return metrics[i].Hour > metrics[j].Hour
+	})
+	if len(metrics) > limit {
+		metrics = metrics[:limit]
+	}
+	return metrics, nil
+}
+
+func (s *MemoryStore) AppendGameEvent(event GameEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := s.events[event.GameID]
+	for _, e := range events {
+		if e.Seq == event.Seq {
+			return errors.New("duplicate event sequence number")
+		}
+	}
+	if len(events) == 0 {
+		s.gameIDs = append(s.gameIDs, event.GameID)
+	}
+
+	event.ID = uint(len(events) + 1)
+	s.events[event.GameID] = append(events, event)
+	return nil
+}
+
+func (s *MemoryStore) GetGameEvents(gameID string) ([]GameEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := append([]GameEvent(nil), s.events[gameID]...)
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Seq < events[j].Seq
+	})
+	return events, nil
+}
+
+func (s *MemoryStore) GetUnfinishedGameIDs() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0)
+	for _, id := range s.gameIDs {
+		created, finished := false, false
+		for _, e := range s.events[id] {
+			switch e.Type {
+			case "created":
+				created = true
+			case "finished":
+				finished = true
+			}
+		}
+		if created && !finished {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) CreateUser(user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createUser(user)
+}
+
+// createUser is CreateUser for callers that hold s.mu
+func (s *MemoryStore) createUser(user *User) error {
+	user.Skeleton = names.Skeleton(user.Username)
+	for _, u := range s.users {
+		if u.Username == user.Username || u.Skeleton == user.Skeleton {
+			return ErrUsernameTaken
+		}
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	u := *user
+	s.users[u.ID] = &u
+	return nil
+}
+
+func (s *MemoryStore) GetUser(id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (s *MemoryStore) GetUserByUsername(username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Username == username {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) FindConfusableUser(username string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	skeleton := names.Skeleton(username)
+	for _, u := range s.users {
+		if u.Skeleton == skeleton {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) SetUserRole(id, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Role = role
+	return nil
+}
+
+func (s *MemoryStore) ListStaff() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []User
+	for _, u := range s.users {
+		if u.Role != "" && u.Role != "player" {
+			users = append(users, *u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (s *MemoryStore) CreateIdentity(identity *Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.identityLinked(identity) {
+		return ErrIdentityLinked
+	}
+	s.addIdentity(identity)
+	return nil
+}
+
+func (s *MemoryStore) CreateUserWithIdentity(user *User, identity *Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.identityLinked(identity) {
+		return ErrIdentityLinked
+	}
+	if err := s.createUser(user); err != nil {
+		return err
+	}
+	identity.UserID = user.ID
+	s.addIdentity(identity)
+	return nil
+}
+
+// identityLinked reports whether identity's issuer and subject are already
+// linked. Callers must hold s.mu.
+func (s *MemoryStore) identityLinked(identity *Identity) bool {
+	for _, existing := range s.idents {
+		if existing.Issuer == identity.Issuer && existing.Subject == identity.Subject {
+			return true
+		}
+	}
+	return false
+}
+
+// addIdentity stores identity. Callers must hold s.mu.
+func (s *MemoryStore) addIdentity(identity *Identity) {
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+	identity.ID = uint(len(s.idents) + 1)
+	s.idents = append(s.idents, *identity)
+}
+
+func (s *MemoryStore) GetIdentity(issuer, subject string) (*Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, identity := range s.idents {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			found := identity
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) CreateFriendship(f *Friendship) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.friendship(f.RequesterID, f.AddresseeID) != nil {
+		return ErrFriendshipExists
+	}
+	now := time.Now()
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = now
+	}
+	f.UpdatedAt = now
+	f.ID = uint(len(s.friends) + 1)
+	stored := *f
+	s.friends = append(s.friends, &stored)
+	return nil
+}
+
+func (s *MemoryStore) GetFriendship(userID, otherID string) (*Friendship, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f := s.friendship(userID, otherID)
+	if f == nil {
+		return nil, ErrNotFound
+	}
+	friendship := *f
+	return &friendship, nil
+}
+
+func (s *MemoryStore) AcceptFriendship(requesterID, addresseeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := s.friendship(requesterID, addresseeID)
+	if f == nil || f.RequesterID != requesterID || f.Status != FriendPending {
+		return ErrNotFound
+	}
+	f.Status = FriendAccepted
+	f.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) DeleteFriendship(userID, otherID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.friends {
+		if (f.RequesterID == userID && f.AddresseeID == otherID) || (f.RequesterID == otherID && f.AddresseeID == userID) {
+			s.friends = append(s.friends[:i], s.friends[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) ListFriendships(userID string) ([]Friendship, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	friendships := make([]Friendship, 0)
+	for _, f := range s.friends {
+		if f.RequesterID == userID || f.AddresseeID == userID {
+			friendships = append(friendships, *f)
+		}
+	}
+	return friendships, nil
+}
+
+// friendship finds the friendship between two users. Callers must hold s.mu.
+func (s *MemoryStore) friendship(userID, otherID string) *Friendship {
+	for _, f := range s.friends {
+		if (f.RequesterID == userID && f.AddresseeID == otherID) || (f.RequesterID == otherID && f.AddresseeID == userID) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateBlock(b *Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.blocks {
+		if existing.BlockerID == b.BlockerID && existing.BlockedID == b.BlockedID {
+			return nil
+		}
+	}
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	b.ID = uint(len(s.blocks) + 1)
+	s.blocks = append(s.blocks, *b)
+	return nil
+}
+
+func (s *MemoryStore) DeleteBlock(blockerID, blockedID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, b := range s.blocks {
+		if b.BlockerID == blockerID && b.BlockedID == blockedID {
+			s.blocks = append(s.blocks[:i], s.blocks[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) ListBlocks(blockerID string) ([]Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	blocks := make([]Block, 0)
+	for _, b := range s.blocks {
+		if b.BlockerID == blockerID {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks, nil
+}
+
+func (s *MemoryStore) IsBlocked(userID, otherID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, b := range s.blocks {
+		if (b.BlockerID == userID && b.BlockedID == otherID) || (b.BlockerID == otherID && b.BlockedID == userID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) CreateReport(r *Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Status == "" {
+		r.Status = ReportOpen
+	}
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	r.ID = uint(len(s.reports) + 1)
+	stored := *r
+	s.reports = append(s.reports, &stored)
+	return nil
+}
+
+func (s *MemoryStore) GetReport(id uint) (*Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.reports {
+		if r.ID == id {
+			report := *r
+			return &report, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) ListReports(status string, limit int) ([]Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reports := make([]Report, 0)
+	for _, r := range s.reports {
+		if status != "" && r.Status != status {
+			continue
+		}
+		reports = append(reports, *r)
+		if len(reports) == limit {
+			break
+		}
+	}
+	return reports, nil
+}
+
+func (s *MemoryStore) HasReported(reporterID, gameID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.reports {
+		if r.ReporterID == reporterID && r.GameID == gameID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) ResolveReport(id uint, status, resolution, resolvedBy string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.reports {
+		if r.ID == id {
+			r.Status = status
+			r.Resolution = resolution
+			r.ResolvedBy = resolvedBy
+			r.ResolvedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) CreateBan(b *Ban) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	s.banID++
+	b.ID = s.banID
+	s.bans = append(s.bans, *b)
+	return nil
+}
+
+func (s *MemoryStore) DeleteBan(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, b := range s.bans {
+		if b.ID == id {
+			s.bans = append(s.bans[:i], s.bans[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) ListBans(now time.Time) ([]Ban, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bans := make([]Ban, 0)
+	for _, b := range s.bans {
+		if b.Active(now) {
+			bans = append(bans, b)
+		}
+	}
+	return bans, nil
+}
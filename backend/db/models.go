@@ -1,7 +1,6 @@
 package db
 
 import (
-	"4-in-a-row/config"
 	"log"
 	"time"
 
@@ -10,7 +9,8 @@ import (
 )
 
 type PlayerData struct {
-	ID       string `json:"id"`
+	ID       string `json:"id,omitempty"`     // Session player ID; left out of public event logs
+	UserID   string `json:"userId,omitempty"` // Account ID; empty for guests and bots
 	Username string `json:"username"`
 	Symbol   int    `json:"symbol"`
 	Type     string `json:"type"` // "human" or "bot"
@@ -30,32 +30,33 @@ type GameResult struct {
 	Player1   PlayerData `gorm:"type:jsonb;serializer:json"`
 	Player2   PlayerData `gorm:"type:jsonb;serializer:json"`
 	Winner    string     `gorm:"index"`
+	WinnerID  string     `gorm:"index"` // Account ID of the winner, if they have one
 	Moves     []MoveData `gorm:"type:jsonb;serializer:json"`
 	Duration  int64
 	CreatedAt time.Time
 }
 
-var DB *gorm.DB
+// GormStore is the PostgreSQL-backed Store
+type GormStore struct {
+	DB *gorm.DB
+}
 
-// InitDB initializes the database connection and runs migrations
-func InitDB() error {
-	cfg := config.Get()
-	dsn := cfg.DatabaseURL
+// Open connects to the database and runs migrations
+func Open(dsn string) (*GormStore, error) {
 	if dsn == "" {
-		return &ConfigError{"DATABASE_URL not configured"}
+		return nil, &ConfigError{"DATABASE_URL not configured"}
 	}
 
 	log.Println("Connecting to database...")
 
-	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	sqlDB, err := DB.DB()
+	sqlDB, err := conn.DB()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	sqlDB.SetMaxIdleConns(10)
@@ -63,36 +64,61 @@ func InitDB() error {
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	// Auto-migrate schema
-	if err := DB.AutoMigrate(&GameResult{}, &PlayerStats{}, &GameMetrics{}); err != nil {
-		return err
+	if err := conn.AutoMigrate(&GameResult{}, &PlayerStats{}, &GameMetrics{}, &GameEvent{}, &User{}, &Friendship{}, &Block{}, &Report{}, &Ban{}, &Identity{}); err != nil {
+		return nil, err
+	}
+
+	// Usernames stopped being unique in player_stats once stats moved to user IDs
+	if conn.Migrator().HasIndex(&PlayerStats{}, "idx_player_stats_username") {
+		if err := conn.Migrator().DropIndex(&PlayerStats{}, "idx_player_stats_username"); err != nil {
+			return nil, err
+		}
+	}
+
+	store := &GormStore{DB: conn}
+	if err := store.backfillSkeletons(); err != nil {
+		return nil, err
 	}
 
 	log.Println("Database connected successfully")
-	return nil
+	return store, nil
 }
 
 // SaveGameResult persists a completed game to the database
-func SaveGameResult(gameID string, p1, p2 PlayerData, winner string, moves []MoveData, duration int64) {
-	if DB == nil {
-		log.Println("Database not initialized, skipping save")
-		return
+func (s *GormStore) SaveGameResult(result *GameResult) error {
+	if result.CreatedAt.IsZero() {
+		result.CreatedAt = time.Now()
 	}
+	return s.DB.Create(result).Error
+}
 
-	result := GameResult{
-		GameID:    gameID,
-		Player1:   p1,
-		Player2:   p2,
-		Winner:    winner,
-		Moves:     moves,
-		Duration:  duration,
-		CreatedAt: time.Now(),
+// GetGameResult returns the stored result of a finished game
+func (s *GormStore) GetGameResult(gameID string) (*GameResult, error) {
+	var result GameResult
+	if err := s.DB.Where("game_id = ?", gameID).First(&result).Error; err != nil {
+		return nil, err
 	}
+	return &result, nil
+}
 
-	if err := DB.Create(&result).Error; err != nil {
-		log.Printf("Failed to save game result: %v", err)
-	} else {
-		log.Printf("Game result saved: %s won, %d moves recorded", winner, len(moves))
-	}
+// RecentGames returns the latest finished games, newest first
+func (s *GormStore) RecentGames(limit int) ([]GameResult, error) {
+	var games []GameResult
+	err := s.DB.Order("created_at DESC").Limit(limit).Find(&games).Error
+	return games, err
+}
+
+// TopWinners returns the players with the most wins
+func (s *GormStore) TopWinners(limit int) ([]WinnerCount, error) {
+	var results []WinnerCount
+	err := s.DB.Model(&GameResult{}).
+		Select("winner, count(*) as wins").
+		Where("winner != ?", "draw").
+		Group("winner").
+		Order("wins desc").
+		Limit(limit).
+		Scan(&results).Error
+	return results, err
 }
 
 // ConfigError represents a configuration error
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"time"
+)
+
+// Report states
+const (
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"  // Action was taken
+	ReportDismissed = "dismissed" // No action needed
+)
+
+// Block stops two accounts from being paired. It applies both ways, but only
+// the blocker can lift it.
+type Block struct {
+	ID        uint   `gorm:"primaryKey"`
+	BlockerID string `gorm:"uniqueIndex:idx_block_pair;index"`
+	BlockedID string `gorm:"uniqueIndex:idx_block_pair;index"`
+	CreatedAt time.Time
+}
+
+// Report is a complaint about an opponent in a finished game, queued for
+// moderators together with the game's moves
+type Report struct {
+	ID           uint   `gorm:"primaryKey"`
+	GameID       string `gorm:"index"`
+	ReporterID   string `gorm:"index"`
+	ReporterName string
+	ReportedID   string `gorm:"index"` // Empty when the reported player was a guest
+	ReportedName string
+	Reason       string
+	Details      string
+	Moves        []MoveData `gorm:"type:jsonb;serializer:json"` // No chat log: games have no chat yet
+	Status       string     `gorm:"index"`
+	Resolution   string     // Moderator's note
+	ResolvedBy   string     // Account ID of the moderator
+	ResolvedAt   *time.Time
+	CreatedAt    time.Time
+}
+
+// CreateBlock blocks BlockedID for BlockerID; blocking twice is not an error
+func (s *GormStore) CreateBlock(b *Block) error {
+	var count int64
+	err := s.DB.Model(&Block{}).
+		Where("blocker_id = ? AND blocked_id = ?", b.BlockerID, b.BlockedID).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	return s.DB.Create(b).Error
+}
+
+// DeleteBlock lifts blockerID's block of blockedID
+func (s *GormStore) DeleteBlock(blockerID, blockedID string) error {
+	result := s.DB.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&Block{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListBlocks returns the accounts blockerID has blocked
+func (s *GormStore) ListBlocks(blockerID string) ([]Block, error) {
+	var blocks []Block
+	err := s.DB.Where("blocker_id = ?", blockerID).Order("created_at").Find(&blocks).Error
+	return blocks, err
+}
+
+// IsBlocked reports whether either account has blocked the other
+func (s *GormStore) IsBlocked(userID, otherID string) (bool, error) {
+	var count int64
+	err := s.DB.Model(&Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)",
+			userID, otherID, otherID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CreateReport queues a report for moderation
+func (s *GormStore) CreateReport(r *Report) error {
+	if r.Status == "" {
+		r.Status = ReportOpen
+	}
+	return s.DB.Create(r).Error
+}
+
+// GetReport looks a report up by ID
+func (s *GormStore) GetReport(id uint) (*Report, error) {
+	var r Report
+	if err := s.DB.First(&r, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &r, nil
+}
+
+// ListReports returns reports in the given status, or all reports if status
+// is empty, oldest first so the queue is worked in order
+func (s *GormStore) ListReports(status string, limit int) ([]Report, error) {
+	query := s.DB.Order("created_at").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var reports []Report
+	err := query.Find(&reports).Error
+	return reports, err
+}
+
+// HasReported reports whether reporterID already reported someone in gameID
+func (s *GormStore) HasReported(reporterID, gameID string) (bool, error) {
+	var count int64
+	err := s.DB.Model(&Report{}).
+		Where("reporter_id = ? AND game_id = ?", reporterID, gameID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ResolveReport closes a report with the moderator's decision
+func (s *GormStore) ResolveReport(id uint, status, resolution, resolvedBy string, at time.Time) error {
+	result := s.DB.Model(&Report{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      status,
+		"resolution":  resolution,
+		"resolved_by": resolvedBy,
+		"resolved_at": at,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+// PlayerKey identifies a player across games: accounts by UserID, guests
+// and bots by Username
+type PlayerKey struct {
+	UserID   string
+	Username string
+}
+
+// Matches reports whether p is the player k identifies
+func (k PlayerKey) Matches(p PlayerData) bool {
+	if k.UserID != "" {
+		return p.UserID == k.UserID
+	}
+	return p.UserID == "" && p.Username == k.Username
+}
+
+// Outcome returns "win", "loss" or "draw" for k in a game they played
+func (k PlayerKey) Outcome(r GameResult) string {
+	switch {
+	case r.Winner == "draw":
+		return "draw"
+	case k.UserID != "" && r.WinnerID == k.UserID:
+		return "win"
+	case k.UserID == "" && r.WinnerID == "" && r.Winner == k.Username:
+		return "win"
+	default:
+		return "loss"
+	}
+}
+
+// playerCondition selects the games where the given side ("player1" or
+// "player2") was k
+func playerCondition(db *gorm.DB, side string, k PlayerKey) *gorm.DB {
+	if k.UserID != "" {
+		return db.Where(side+"->>'userId' = ?", k.UserID)
+	}
+	return db.Where("(COALESCE("+side+"->>'userId', '') = '' AND "+side+"->>'username' = ?)", k.Username)
+}
+
+// PlayerGames returns the finished games k played, newest first. A limit of
+// 0 returns them all.
+func (s *GormStore) PlayerGames(k PlayerKey, limit int) ([]GameResult, error) {
+	query := s.DB.
+		Where(playerCondition(s.DB, "player1", k).Or(playerCondition(s.DB, "player2", k))).
+		Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	var games []GameResult
+	err := query.Find(&games).Error
+	return games, err
+}
+
+// HeadToHead returns the finished games between a and b, newest first
+func (s *GormStore) HeadToHead(a, b PlayerKey) ([]GameResult, error) {
+	aFirst := playerCondition(s.DB, "player1", a).Where(playerCondition(s.DB, "player2", b))
+	bFirst := playerCondition(s.DB, "player1", b).Where(playerCondition(s.DB, "player2", a))
+
+	var games []GameResult
+	err := s.DB.Where(aFirst.Or(bFirst)).Order("created_at DESC").Find(&games).Error
+	return games, err
+}
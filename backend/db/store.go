@@ -0,0 +1,81 @@
+package db
+
+import "time"
+
+// Store is the persistence layer used by the game server and analytics consumers
+type Store interface {
+	// Game results
+	SaveGameResult(result *GameResult) error
+	GetGameResult(gameID string) (*GameResult, error)
+	RecentGames(limit int) ([]GameResult, error)
+	TopWinners(limit int) ([]WinnerCount, error)
+
+	// Aggregated analytics
+	UpdatePlayerStats(player PlayerData, won bool, isDraw bool, duration int64) error
+	UpdateGameMetrics(duration int64, timestamp time.Time) error
+	GetTopPlayers(limit int) ([]PlayerStats, error)
+	GetGameSummary(today time.Time) (*GameSummary, error)
+	RecentMetrics(since time.Time, limit int) ([]GameMetrics, error)
+
+	// Player profiles
+	PlayerGames(k PlayerKey, limit int) ([]GameResult, error)
+	HeadToHead(a, b PlayerKey) ([]GameResult, error)
+
+	// Game event log
+	AppendGameEvent(event GameEvent) error
+	GetGameEvents(gameID string) ([]GameEvent, error)
+	GetUnfinishedGameIDs() ([]string, error)
+
+	// Accounts
+	CreateUser(user *User) error
+	GetUser(id string) (*User, error)
+	GetUserByUsername(username string) (*User, error)
+	FindConfusableUser(username string) (*User, error)
+	SetUserRole(id, role string) error
+	ListStaff() ([]User, error)
+	CreateIdentity(identity *Identity) error
+	CreateUserWithIdentity(user *User, identity *Identity) error
+	GetIdentity(issuer, subject string) (*Identity, error)
+
+	// Friends
+	CreateFriendship(f *Friendship) error
+	GetFriendship(userID, otherID string) (*Friendship, error)
+	AcceptFriendship(requesterID, addresseeID string) error
+	DeleteFriendship(userID, otherID string) error
+	ListFriendships(userID string) ([]Friendship, error)
+
+	// Blocks and moderation
+	CreateBlock(b *Block) error
+	DeleteBlock(blockerID, blockedID string) error
+	ListBlocks(blockerID string) ([]Block, error)
+	IsBlocked(userID, otherID string) (bool, error)
+	CreateReport(r *Report) error
+	GetReport(id uint) (*Report, error)
+	ListReports(status string, limit int) ([]Report, error)
+	HasReported(reporterID, gameID string) (bool, error)
+	ResolveReport(id uint, status, resolution, resolvedBy string, at time.Time) error
+
+	// Bans
+	CreateBan(b *Ban) error
+	DeleteBan(id uint) error
+	ListBans(now time.Time) ([]Ban, error)
+}
+
+// WinnerCount is a leaderboard row
+type WinnerCount struct {
+	Winner string
+	Wins   int64
+}
+
+// GameSummary holds the headline numbers shown on the metrics page
+type GameSummary struct {
+	TotalGames      int64
+	TotalPlayers    int64
+	AverageDuration float64
+	GamesToday      int64
+}
+
+var (
+	_ Store = (*GormStore)(nil)
+	_ Store = (*MemoryStore)(nil)
+)
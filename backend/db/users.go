@@ -0,0 +1,112 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"4-in-a-row/names"
+
+	"gorm.io/gorm"
+)
+
+// ErrUsernameTaken is returned when registering a username that already has
+// an account, or looks like one that does
+var ErrUsernameTaken = errors.New("username already registered")
+
+// User is a registered account. Its ID is the stable identity games and
+// stats are linked to; the username is only what other players see.
+type User struct {
+	ID           string `gorm:"primaryKey"`
+	Username     string `gorm:"uniqueIndex"`
+	Skeleton     string `gorm:"index"` // names.Skeleton of Username, set by CreateUser
+	PasswordHash string
+	Role         string `gorm:"index"` // auth.Role; empty for players
+	CreatedAt    time.Time
+}
+
+// CreateUser registers a new account
+func (s *GormStore) CreateUser(user *User) error {
+	user.Skeleton = names.Skeleton(user.Username)
+
+	var count int64
+	err := s.DB.Model(&User{}).
+		Where("username = ? OR skeleton = ?", user.Username, user.Skeleton).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrUsernameTaken
+	}
+	return s.DB.Create(user).Error
+}
+
+// GetUser looks an account up by ID
+func (s *GormStore) GetUser(id string) (*User, error) {
+	var user User
+	if err := s.DB.Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+// GetUserByUsername looks an account up by username
+func (s *GormStore) GetUserByUsername(username string) (*User, error) {
+	var user User
+	if err := s.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+// FindConfusableUser looks up the account whose username has the same
+// skeleton as username, if any
+func (s *GormStore) FindConfusableUser(username string) (*User, error) {
+	var user User
+	if err := s.DB.Where("skeleton = ?", names.Skeleton(username)).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+// SetUserRole changes an account's role
+func (s *GormStore) SetUserRole(id, role string) error {
+	res := s.DB.Model(&User{}).Where("id = ?", id).Update("role", role)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListStaff returns the accounts with a role other than player, by username
+func (s *GormStore) ListStaff() ([]User, error) {
+	var users []User
+	err := s.DB.Where("role <> ? AND role <> ?", "", "player").Order("username").Find(&users).Error
+	return users, err
+}
+
+// backfillSkeletons fills in the skeletons of accounts created before
+// usernames had them
+func (s *GormStore) backfillSkeletons() error {
+	var users []User
+	if err := s.DB.Where("skeleton = ? OR skeleton IS NULL", "").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, u := range users {
+		if err := s.DB.Model(&User{}).Where("id = ?", u.ID).Update("skeleton", names.Skeleton(u.Username)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notFound maps gorm's missing-record error to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
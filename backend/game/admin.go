@@ -0,0 +1,167 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"4-in-a-row/db"
+)
+
+// Reasons a game ended, sent in GAME_OVER when it was not played out
+const (
+	EndAborted   = "aborted"   // Ended by an operator
+	EndAbandoned = "abandoned" // Neither player came back to a game recovered after a restart
+)
+
+// PlayerSnapshot describes one seat of a game for operators
+type PlayerSnapshot struct {
+	PlayerID    string `json:"playerId"`
+	UserID      string `json:"userId,omitempty"`
+	Username    string `json:"username"`
+	Symbol      int    `json:"symbol"`
+	Type        string `json:"type"`
+	IsConnected bool   `json:"isConnected"`
+	LatencyMs   int    `json:"latencyMs,omitempty"`
+}
+
+// GameSnapshot is a consistent copy of a game's state. Moves, Grid and
+// Events are only filled in by Snapshot(true).
+type GameSnapshot struct {
+	ID         string           `json:"id"`
+	State      string           `json:"state"`
+	Turn       int              `json:"turn"`
+	Winner     int              `json:"winner"`
+	MoveNumber int              `json:"moveNumber"`
+	StartedAt  time.Time        `json:"startedAt"`
+	LastMoveAt time.Time        `json:"lastMoveAt"`
+	Players    []PlayerSnapshot `json:"players"`
+	Hash       string           `json:"hash,omitempty"`
+	Grid       *[Rows][Cols]int `json:"grid,omitempty"`
+	Moves      []db.MoveData    `json:"moves,omitempty"`
+	Events     []db.GameEvent   `json:"events,omitempty"`
+}
+
+// QueueEntry describes a player waiting in matchmaking for operators
+type QueueEntry struct {
+	PlayerID       string `json:"playerId"`
+	UserID         string `json:"userId,omitempty"`
+	Username       string `json:"username"`
+	Position       int    `json:"position"`
+	WaitingSeconds int    `json:"waitingSeconds"`
+}
+
+// Snapshot copies the game's state; full adds the board, moves and event log
+func (g *Game) Snapshot(full bool) GameSnapshot {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	s := GameSnapshot{
+		ID:         g.ID,
+		State:      g.State,
+		Turn:       g.Turn,
+		Winner:     g.Winner,
+		MoveNumber: g.MoveNumber,
+		StartedAt:  g.StartTime,
+		LastMoveAt: g.LastMove,
+		Players:    []PlayerSnapshot{playerSnapshot(g.Player1), playerSnapshot(g.Player2)},
+	}
+	if full {
+		grid := g.Board.Grid
+		s.Grid = &grid
+		s.Hash = g.Board.Hash()
+		s.Moves = append([]db.MoveData{}, g.Moves...)
+		s.Events = append([]db.GameEvent{}, g.Events...)
+	}
+	return s
+}
+
+func playerSnapshot(p *Player) PlayerSnapshot {
+	return PlayerSnapshot{
+		PlayerID:    p.ID,
+		UserID:      p.UserID,
+		Username:    p.Username,
+		Symbol:      p.Symbol,
+		Type:        getPlayerType(p),
+		IsConnected: p.IsConnected,
+		LatencyMs:   int(p.Latency.Milliseconds()),
+	}
+}
+
+// ListGames snapshots every game the manager holds, oldest first
+func (gm *GameManager) ListGames() []GameSnapshot {
+	gm.Mutex.RLock()
+	games := make([]*Game, 0, len(gm.Games))
+	for _, g := range gm.Games {
+		games = append(games, g)
+	}
+	gm.Mutex.RUnlock()
+
+	snapshots := make([]GameSnapshot, 0, len(games))
+	for _, g := range games {
+		snapshots = append(snapshots, g.Snapshot(false))
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].StartedAt.Before(snapshots[j].StartedAt) })
+	return snapshots
+}
+
+// Entries lists the players waiting in the queue, in queue order
+func (m *Matchmaker) Entries() []QueueEntry {
+	m.Mutex.Lock()
+	defer m.Mutex.Unlock()
+
+	entries := make([]QueueEntry, 0, len(m.Queue))
+	for i, p := range m.Queue {
+		entry := QueueEntry{PlayerID: p.ID, UserID: p.UserID, Username: p.Username, Position: i + 1}
+		if w := m.waiting[p]; w != nil {
+			entry.WaitingSeconds = int(m.Clock.Since(w.joinedAt).Seconds())
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Abort ends an active game on an operator's behalf. A winner of 1 or 2 (or
+// 3 for a draw) finishes it like any other game, with its result saved; 0
+// ends it without a result, which is kept out of the results and analytics.
+func (g *Game) Abort(winner int) error {
+	if winner < 0 || winner > 3 {
+		return fmt.Errorf("winner must be 0 to 3")
+	}
+
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	if g.State != "active" {
+		return &ProtocolError{Code: ErrCodeGameFinished, Message: "Game is already over"}
+	}
+
+	log.Printf("Game %s aborted by an operator (winner: %d)", g.ID, winner)
+	g.State = "finished"
+	g.Winner = winner
+	g.endReason = EndAborted
+	g.record(EventAborted, db.GameEventData{Winner: winner})
+
+	if winner != 0 {
+		g.BroadcastGameOver()
+		return nil
+	}
+	g.endWithoutResult()
+	return nil
+}
+
+// endWithoutResult tells both players the game is over with no winner and
+// schedules its cleanup. Nothing is saved to the results or analytics.
+// Callers must hold g.Mutex and have set State and endReason.
+func (g *Game) endWithoutResult() {
+	msg := Message{Type: MsgGameOver, Payload: g.gameOverPayload()}
+	g.Player1.SendMessage(msg)
+	g.Player2.SendMessage(msg)
+	g.setPresence(StatusIdle)
+	g.record(EventFinished, db.GameEventData{})
+
+	g.Clock.AfterFunc(GameCleanupDelay, func() {
+		g.Manager.RemoveGame(g.ID)
+	})
+}
@@ -0,0 +1,224 @@
+package game
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Timing used by matchmaking and games
+const (
+	MatchTimeout      = 10 * time.Second       // Wait for a human opponent before falling back to a bot
+	BotMoveDelay      = 500 * time.Millisecond // Realistic delay before the bot plays
+	ReconnectTimeout  = 30 * time.Second       // Grace period before a disconnected player forfeits
+	GameCleanupDelay  = 5 * time.Second        // Keep finished games around so clients receive GAME_OVER
+	ReconnectTokenTTL = 6 * time.Hour          // Lifetime of a reconnect token; renewed on every reconnect
+
+	QueueStatusInterval = 2 * time.Second // How often waiting players get QUEUE_STATUS
+)
+
+// Clock abstracts time so timers can be driven manually in tests
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	NewTicker(d time.Duration) Ticker
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker delivers ticks at a fixed interval until stopped
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer is a scheduled callback that can be cancelled
+type Timer interface {
+	Stop() bool
+}
+
+// RealClock is the Clock backed by the time package
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (RealClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// FakeClock is a Clock that only moves when Advance is called
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	clock    *FakeClock
+	deadline time.Time
+	period   time.Duration // Non-zero for tickers
+	ch       chan time.Time
+	fn       func()
+}
+
+// NewFakeClock returns a FakeClock starting at the given time
+func NewFakeClock(start time.Time) *FakeClock {
+	c := &FakeClock{now: start}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("game: non-positive interval for FakeClock.NewTicker")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &fakeWaiter{
+		clock:    c,
+		deadline: c.now.Add(d),
+		period:   d,
+		ch:       make(chan time.Time, 1),
+	}
+	c.addWaiter(w)
+	return &fakeTicker{w}
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &fakeWaiter{
+		clock:    c,
+		deadline: c.now.Add(d),
+		fn:       f,
+	}
+	c.addWaiter(w)
+	return &fakeTimer{w}
+}
+
+// Advance moves the clock forward, firing every timer and ticker that falls
+// due along the way in deadline order. Callbacks run synchronously.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+
+	for len(c.waiters) > 0 && !c.waiters[0].deadline.After(target) {
+		w := c.waiters[0]
+		c.now = w.deadline
+
+		if w.period > 0 {
+			w.deadline = w.deadline.Add(w.period)
+			c.sortWaiters()
+			select {
+			case w.ch <- c.now:
+			default: // Drop the tick if the reader is behind, like time.Ticker
+			}
+			continue
+		}
+
+		c.waiters = c.waiters[1:]
+		c.mu.Unlock()
+		w.fn()
+		c.mu.Lock()
+	}
+
+	c.now = target
+	c.mu.Unlock()
+}
+
+// BlockUntil waits until at least n timers or tickers are pending. Use it to
+// make sure a goroutine has scheduled its work before calling Advance.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+// Pending returns the number of timers and tickers waiting to fire
+func (c *FakeClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+func (c *FakeClock) addWaiter(w *fakeWaiter) {
+	c.waiters = append(c.waiters, w)
+	c.sortWaiters()
+	c.cond.Broadcast()
+}
+
+func (c *FakeClock) removeWaiter(w *fakeWaiter) bool {
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *FakeClock) sortWaiters() {
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+}
+
+func (w *fakeWaiter) cancel() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	return w.clock.removeWaiter(w)
+}
+
+type fakeTicker struct {
+	w *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *fakeTicker) Stop() {
+	t.w.cancel()
+}
+
+type fakeTimer struct {
+	w *fakeWaiter
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.w.cancel()
+}
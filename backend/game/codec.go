@@ -0,0 +1,154 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// WebSocket subprotocols selecting the wire encoding
+const (
+	SubprotocolJSON    = "fourinarow.json"
+	SubprotocolMsgpack = "fourinarow.msgpack"
+)
+
+// Subprotocols lists the encodings offered during the WebSocket upgrade, in
+// order of preference when a client offers several
+var Subprotocols = []string{SubprotocolMsgpack, SubprotocolJSON}
+
+// Codec encodes messages for the wire
+type Codec interface {
+	Name() string
+	FrameType() int // websocket.TextMessage or websocket.BinaryMessage
+	Encode(msg Message) ([]byte, error)
+	Decode(data []byte) (ClientMessage, error)
+}
+
+// CodecFor returns the codec for a negotiated subprotocol; JSON is the default
+func CodecFor(subprotocol string) Codec {
+	if subprotocol == SubprotocolMsgpack {
+		return MsgpackCodec{}
+	}
+	return JSONCodec{}
+}
+
+// JSONCodec is the default text encoding
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string {
+	return SubprotocolJSON
+}
+
+func (JSONCodec) FrameType() int {
+	return websocket.TextMessage
+}
+
+func (JSONCodec) Encode(msg Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (JSONCodec) Decode(data []byte) (ClientMessage, error) {
+	return DecodeClientMessage(data)
+}
+
+// MsgpackCodec is the compact binary encoding. Messages are normalised
+// through their JSON form so both encodings carry exactly the same fields.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Name() string {
+	return SubprotocolMsgpack
+}
+
+func (MsgpackCodec) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+func (MsgpackCodec) Encode(msg Message) ([]byte, error) {
+	value, err := jsonValue(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (MsgpackCodec) Decode(data []byte) (ClientMessage, error) {
+	var raw struct {
+		ID      string      `msgpack:"id"`
+		Type    string      `msgpack:"type"`
+		Payload interface{} `msgpack:"payload"`
+	}
+	if err := msgpack.Unmarshal(data, &raw); err != nil {
+		return ClientMessage{}, badMessage("message is not valid MessagePack")
+	}
+
+	if raw.Type == "" {
+		return ClientMessage{}, badMessage("message type is missing")
+	}
+
+	// Hand the payload to the same typed decoders the JSON path uses
+	payload, err := json.Marshal(raw.Payload)
+	if err != nil {
+		return ClientMessage{}, badMessage("message payload cannot be represented")
+	}
+	return ClientMessage{ID: raw.ID, Type: raw.Type, Payload: payload}, nil
+}
+
+// jsonValue converts v into generic maps, slices and numbers via its JSON
+// form, keeping integers as integers
+func jsonValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return normaliseNumbers(value), nil
+}
+
+func normaliseNumbers(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case map[string]interface{}:
+		for k, item := range x {
+			x[k] = normaliseNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range x {
+			x[i] = normaliseNumbers(item)
+		}
+	}
+	return v
+}
+
+// WriteMessage encodes msg for this client and writes it to conn
+func (c ClientInfo) WriteMessage(conn *websocket.Conn, msg Message) error {
+	codec := c.Codec
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	data, err := codec.Encode(c.Adapt(msg))
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(codec.FrameType(), data)
+}
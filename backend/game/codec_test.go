@@ -0,0 +1,259 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+var timeType = reflect.TypeOf(time.Time{})
+
+// sample returns a value of type t with every field set, so omitempty fields
+// are on the wire too
+func sample(t reflect.Type) reflect.Value {
+	v := reflect.New(t).Elem()
+	switch {
+	case t == rawMessageType:
+		v.Set(reflect.ValueOf(json.RawMessage(`{"column":3}`)))
+		return v
+	case t == timeType:
+		v.Set(reflect.ValueOf(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString("sample")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(7)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(7)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(2.5)
+	case reflect.Ptr:
+		v.Set(sample(t.Elem()).Addr())
+	case reflect.Slice:
+		v.Set(reflect.Append(reflect.MakeSlice(t, 0, 1), sample(t.Elem())))
+	case reflect.Array:
+		for i := 0; i < t.Len(); i++ {
+			v.Index(i).Set(sample(t.Elem()))
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(t))
+		v.SetMapIndex(sample(t.Key()), sample(t.Elem()))
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() {
+				v.Field(i).Set(sample(t.Field(i).Type))
+			}
+		}
+	case reflect.Interface:
+		v.Set(reflect.ValueOf("sample"))
+	}
+	return v
+}
+
+// canonical decodes a JSON or MessagePack message into generic values with
+// every number as a float64, so the two can be compared
+func canonical(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, item := range x {
+			x[k] = canonical(item)
+		}
+	case []interface{}:
+		for i, item := range x {
+			x[i] = canonical(item)
+		}
+	default:
+		rv := reflect.ValueOf(v)
+		if rv.IsValid() {
+			switch rv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return float64(rv.Int())
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				return float64(rv.Uint())
+			case reflect.Float32, reflect.Float64:
+				return rv.Float()
+			}
+		}
+	}
+	return v
+}
+
+func decodeJSON(t *testing.T, data []byte) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return canonical(v)
+}
+
+// decodePayload is decodeJSON for a client payload, which is empty when the
+// JSON message had none and null when the MessagePack one had none; the
+// handlers treat both alike
+func decodePayload(t *testing.T, raw json.RawMessage) interface{} {
+	t.Helper()
+	if len(raw) == 0 {
+		return nil
+	}
+	return decodeJSON(t, raw)
+}
+
+func decodeMsgpack(t *testing.T, data []byte) interface{} {
+	t.Helper()
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetMapDecoder(func(d *msgpack.Decoder) (interface{}, error) {
+		return d.DecodeUntypedMap()
+	})
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("invalid MessagePack: %v", err)
+	}
+	return canonical(stringKeys(v))
+}
+
+// stringKeys turns the map[interface{}]interface{} the decoder may produce
+// into map[string]interface{}
+func stringKeys(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, item := range x {
+			m[fmt.Sprint(k)] = stringKeys(item)
+		}
+		return m
+	case map[string]interface{}:
+		for k, item := range x {
+			x[k] = stringKeys(item)
+		}
+	case []interface{}:
+		for i, item := range x {
+			x[i] = stringKeys(item)
+		}
+	}
+	return v
+}
+
+// typedPayload decodes a generic payload back into the spec's payload type
+func typedPayload(t *testing.T, payload interface{}, typ reflect.Type) interface{} {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("payload cannot be re-encoded: %v", err)
+	}
+	out := reflect.New(typ)
+	if err := json.Unmarshal(data, out.Interface()); err != nil {
+		t.Fatalf("payload does not decode into %s: %v", typ, err)
+	}
+	return out.Elem().Interface()
+}
+
+func TestCodecsEncodeServerMessagesAlike(t *testing.T) {
+	for _, spec := range Messages {
+		if spec.Direction != FromServer {
+			continue
+		}
+		t.Run(spec.Type, func(t *testing.T) {
+			msg := Message{Type: spec.Type, Seq: 42}
+			var want interface{}
+			if spec.Payload != nil {
+				want = sample(reflect.TypeOf(spec.Payload)).Interface()
+				msg.Payload = want
+			}
+
+			jsonData, err := JSONCodec{}.Encode(msg)
+			if err != nil {
+				t.Fatalf("JSON encode: %v", err)
+			}
+			packed, err := MsgpackCodec{}.Encode(msg)
+			if err != nil {
+				t.Fatalf("MessagePack encode: %v", err)
+			}
+
+			fromJSON, fromMsgpack := decodeJSON(t, jsonData), decodeMsgpack(t, packed)
+			if !reflect.DeepEqual(fromJSON, fromMsgpack) {
+				t.Fatalf("encodings differ:\nJSON:        %#v\nMessagePack: %#v", fromJSON, fromMsgpack)
+			}
+
+			if want != nil {
+				got := typedPayload(t, fromMsgpack.(map[string]interface{})["payload"], reflect.TypeOf(spec.Payload))
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("MessagePack payload does not round-trip:\ngot  %#v\nwant %#v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCodecsDecodeClientMessagesAlike(t *testing.T) {
+	for _, spec := range Messages {
+		if spec.Direction != FromClient {
+			continue
+		}
+		t.Run(spec.Type, func(t *testing.T) {
+			wire := map[string]interface{}{"id": "req-1", "type": spec.Type}
+			var want interface{}
+			if spec.Payload != nil {
+				want = sample(reflect.TypeOf(spec.Payload)).Interface()
+				wire["payload"] = want
+			}
+
+			jsonData, err := json.Marshal(wire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			generic, err := jsonValue(wire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packed, err := msgpack.Marshal(generic)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fromJSON, err := JSONCodec{}.Decode(jsonData)
+			if err != nil {
+				t.Fatalf("JSON decode: %v", err)
+			}
+			fromMsgpack, err := MsgpackCodec{}.Decode(packed)
+			if err != nil {
+				t.Fatalf("MessagePack decode: %v", err)
+			}
+
+			if fromJSON.ID != fromMsgpack.ID || fromJSON.Type != fromMsgpack.Type {
+				t.Fatalf("envelopes differ: JSON %s/%s, MessagePack %s/%s", fromJSON.ID, fromJSON.Type, fromMsgpack.ID, fromMsgpack.Type)
+			}
+			if !reflect.DeepEqual(decodePayload(t, fromJSON.Payload), decodePayload(t, fromMsgpack.Payload)) {
+				t.Fatalf("payloads differ:\nJSON:        %s\nMessagePack: %s", fromJSON.Payload, fromMsgpack.Payload)
+			}
+
+			if want != nil {
+				got := typedPayload(t, decodePayload(t, fromMsgpack.Payload), reflect.TypeOf(spec.Payload))
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("MessagePack payload does not round-trip:\ngot  %#v\nwant %#v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCodecFor(t *testing.T) {
+	if _, ok := CodecFor(SubprotocolMsgpack).(MsgpackCodec); !ok {
+		t.Error("msgpack subprotocol does not select MessagePack")
+	}
+	for _, sub := range []string{"", SubprotocolJSON, "unknown"} {
+		if _, ok := CodecFor(sub).(JSONCodec); !ok {
+			t.Errorf("subprotocol %q does not fall back to JSON", sub)
+		}
+	}
+}
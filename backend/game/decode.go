@@ -0,0 +1,170 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ClientMessage is a message received from a client. The payload is kept raw
+// and decoded into the struct for its type.
+type ClientMessage struct {
+	ID      string          `json:"id,omitempty"` // Optional request ID, echoed in ACK/NACK
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type JoinQueuePayload struct {
+	Username string `json:"username"`
+}
+
+type MovePayload struct {
+	GameID string `json:"gameId"`
+	Column *int   `json:"column"`
+}
+
+// DecodeClientMessage parses a raw frame from a client
+func DecodeClientMessage(data []byte) (ClientMessage, error) {
+	var msg ClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, badMessage("message is not valid JSON")
+	}
+	if msg.Type == "" {
+		return msg, badMessage("message type is missing")
+	}
+	return msg, nil
+}
+
+// DecodeHello decodes a HELLO payload
+func DecodeHello(raw json.RawMessage) (HelloPayload, error) {
+	var hello HelloPayload
+	if err := decodeStrict(raw, &hello); err != nil {
+		return hello, badMessage("HELLO payload must be {version, features}")
+	}
+	return hello, nil
+}
+
+// DecodeJoinQueue decodes a JOIN_QUEUE payload. Legacy clients send the
+// username as a bare string.
+func DecodeJoinQueue(raw json.RawMessage) (JoinQueuePayload, error) {
+	var join JoinQueuePayload
+	raw = bytes.TrimSpace(raw)
+	if isNull(raw) {
+		return join, nil
+	}
+	if raw[0] == '"' {
+		err := json.Unmarshal(raw, &join.Username)
+		if err != nil {
+			return join, badMessage("JOIN_QUEUE username must be a string")
+		}
+		return join, nil
+	}
+	if err := decodeStrict(raw, &join); err != nil {
+		return join, badMessage("JOIN_QUEUE payload must be {username}")
+	}
+	return join, nil
+}
+
+// DecodeReconnect decodes a RECONNECT payload. The token may be sent as a
+// bare string.
+func DecodeReconnect(raw json.RawMessage) (ReconnectRequest, error) {
+	var req ReconnectRequest
+	raw = bytes.TrimSpace(raw)
+	if !isNull(raw) && raw[0] == '"' {
+		if err := json.Unmarshal(raw, &req.Token); err != nil {
+			return req, badMessage("RECONNECT token must be a string")
+		}
+	} else if err := decodeStrict(raw, &req); err != nil {
+		return req, badMessage("RECONNECT payload must be {token, lastSeq}")
+	}
+	if req.Token == "" {
+		return req, badMessage("RECONNECT requires a token")
+	}
+	return req, nil
+}
+
+// DecodeMove decodes a MOVE payload
+func DecodeMove(raw json.RawMessage) (MovePayload, error) {
+	var move MovePayload
+	if err := decodeStrict(raw, &move); err != nil {
+		return move, badMessage("MOVE payload must be {gameId, column}")
+	}
+	if move.GameID == "" {
+		return move, badMessage("MOVE requires a gameId")
+	}
+	if move.Column == nil {
+		return move, badMessage("MOVE requires a column")
+	}
+	return move, nil
+}
+
+// DecodeSync decodes a SYNC payload
+func DecodeSync(raw json.RawMessage) (SyncRequest, error) {
+	var req SyncRequest
+	if err := decodeStrict(raw, &req); err != nil {
+		return req, badMessage("SYNC payload must be {gameId}")
+	}
+	if req.GameID == "" {
+		return req, badMessage("SYNC requires a gameId")
+	}
+	return req, nil
+}
+
+// DecodeLobbySubscribe decodes a LOBBY_SUBSCRIBE payload; the username may
+// be omitted by a connection that already has a player
+func DecodeLobbySubscribe(raw json.RawMessage) (LobbySubscribePayload, error) {
+	var sub LobbySubscribePayload
+	if isNull(raw) {
+		return sub, nil
+	}
+	if err := json.Unmarshal(raw, &sub); err != nil {
+		return sub, badMessage("LOBBY_SUBSCRIBE payload must be {username}")
+	}
+	return sub, nil
+}
+
+// DecodeChallenge decodes a CHALLENGE_POST payload; every field is optional
+func DecodeChallenge(raw json.RawMessage) (ChallengeRequest, error) {
+	var req ChallengeRequest
+	if isNull(raw) {
+		return req, nil
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return req, badMessage("CHALLENGE_POST payload must be {rules, timeControl, rated}")
+	}
+	return req, nil
+}
+
+// DecodeDirectChallenge decodes a CHALLENGE payload
+func DecodeDirectChallenge(raw json.RawMessage) (DirectChallengeRequest, error) {
+	var req DirectChallengeRequest
+	if err := decodeStrict(raw, &req); err != nil || req.UserID == "" {
+		return req, badMessage("CHALLENGE payload must be {userId, rules, timeControl, rated}")
+	}
+	return req, nil
+}
+
+// DecodeChallengeRef decodes a CHALLENGE_CANCEL, CHALLENGE_ACCEPT or
+// CHALLENGE_DECLINE payload
+func DecodeChallengeRef(raw json.RawMessage) (ChallengeRef, error) {
+	var ref ChallengeRef
+	if err := decodeStrict(raw, &ref); err != nil || ref.ChallengeID == "" {
+		return ref, badMessage("payload must be {challengeId}")
+	}
+	return ref, nil
+}
+
+func decodeStrict(raw json.RawMessage, v interface{}) error {
+	if isNull(raw) {
+		return badMessage("payload is missing")
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func isNull(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) == 0 || bytes.Equal(raw, []byte("null"))
+}
+
+func badMessage(message string) *ProtocolError {
+	return &ProtocolError{Code: ErrCodeBadMessage, Message: message}
+}
@@ -0,0 +1,85 @@
+package game
+
+import (
+	"encoding/hex"
+	"hash/fnv"
+)
+
+// DeltaPayload is the GAME_DELTA sent instead of GAME_UPDATE to clients that
+// agreed on FeatureDeltas. It only describes the move; Hash lets the client
+// check its own board and ask for SYNC if they differ.
+type DeltaPayload struct {
+	Column      int    `json:"column"`
+	Row         int    `json:"row"`
+	Player      int    `json:"player"`
+	MoveNumber  int    `json:"moveNumber"`
+	CurrentTurn int    `json:"currentTurn"`
+	Hash        string `json:"hash"`
+}
+
+// SyncRequest asks for a full snapshot of a game
+type SyncRequest struct {
+	GameID string `json:"gameId"`
+}
+
+// SyncPayload is the full position sent in reply to SYNC
+type SyncPayload struct {
+	GameID      string          `json:"gameId"`
+	Grid        [Rows][Cols]int `json:"grid"`
+	CurrentTurn int             `json:"currentTurn"`
+	LastMove    *LastMove       `json:"lastMove,omitempty"`
+	MoveNumber  int             `json:"moveNumber"`
+	Hash        string          `json:"hash"`
+}
+
+// Hash fingerprints the position: FNV-1a (32 bit) over the cells in row-major
+// order, one byte per cell (0 empty, 1 or 2 for the player), as 8 hex digits
+func (b *Board) Hash() string {
+	h := fnv.New32a()
+	cells := make([]byte, 0, Rows*Cols)
+	for r := 0; r < Rows; r++ {
+		for c := 0; c < Cols; c++ {
+			cells = append(cells, byte(b.Grid[r][c]))
+		}
+	}
+	h.Write(cells)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sync sends p a full snapshot of the game
+func (g *Game) Sync(p *Player) {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	p.SendMessage(Message{
+		Type: MsgSync,
+		Payload: SyncPayload{
+			GameID:      g.ID,
+			Grid:        g.Board.Grid,
+			CurrentTurn: g.Turn,
+			LastMove:    g.lastMove(),
+			MoveNumber:  g.MoveNumber,
+			Hash:        g.Board.Hash(),
+		},
+	})
+}
+
+// deltaUpdate rewrites a GAME_UPDATE as a GAME_DELTA; ok is false for updates
+// that do not follow a move
+func deltaUpdate(update GameUpdatePayload) (msg Message, ok bool) {
+	if update.LastMove == nil {
+		return Message{}, false
+	}
+	board := Board{Grid: update.Grid}
+	return Message{
+		Type: MsgDelta,
+		Payload: DeltaPayload{
+			Column:      update.LastMove.Column,
+			Row:         update.LastMove.Row,
+			Player:      update.LastMove.Player,
+			MoveNumber:  update.MoveNumber,
+			CurrentTurn: update.CurrentTurn,
+			Hash:        board.Hash(),
+		},
+	}, true
+}
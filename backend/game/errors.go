@@ -0,0 +1,132 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Error codes sent in ErrorPayload.Code; clients may rely on these staying stable
+const (
+	ErrCodeBadMessage         = "BAD_MESSAGE"
+	ErrCodeUnknownType        = "UNKNOWN_TYPE"
+	ErrCodeHandshakeRequired  = "HANDSHAKE_REQUIRED"
+	ErrCodeUnsupportedVersion = "UNSUPPORTED_VERSION"
+	ErrCodeAlreadyInQueue     = "ALREADY_IN_QUEUE"
+	ErrCodeAlreadyInGame      = "ALREADY_IN_GAME"
+	ErrCodeUsernameTaken      = "USERNAME_TAKEN"
+	ErrCodeUsernameLength     = "USERNAME_INVALID_LENGTH"
+	ErrCodeUsernameCharacters = "USERNAME_INVALID_CHARACTERS"
+	ErrCodeUsernameReserved   = "USERNAME_RESERVED"
+	ErrCodeUsernameBlocked    = "USERNAME_BLOCKED"
+	ErrCodeReconnectFailed    = "RECONNECT_FAILED"
+	ErrCodeGameNotFound       = "GAME_NOT_FOUND"
+	ErrCodeNotInGame          = "NOT_IN_GAME"
+	ErrCodeNotYourTurn        = "NOT_YOUR_TURN"
+	ErrCodeInvalidMove        = "INVALID_MOVE"
+	ErrCodeGameFinished       = "GAME_FINISHED"
+	ErrCodeNotInQueue         = "NOT_IN_QUEUE"
+	ErrCodeRateLimited        = "RATE_LIMITED"
+	ErrCodeMessageTooLarge    = "MESSAGE_TOO_LARGE"
+	ErrCodeTooManyConnections = "TOO_MANY_CONNECTIONS"
+	ErrCodeNotInLobby         = "NOT_IN_LOBBY"
+	ErrCodePlayerBusy         = "PLAYER_BUSY"
+	ErrCodeInvalidChallenge   = "INVALID_CHALLENGE"
+	ErrCodeChallengeNotFound  = "CHALLENGE_NOT_FOUND"
+	ErrCodeLoginRequired      = "LOGIN_REQUIRED"
+	ErrCodeNotFriends         = "NOT_FRIENDS"
+	ErrCodeFriendUnavailable  = "FRIEND_UNAVAILABLE"
+	ErrCodeBlocked            = "BLOCKED"
+	ErrCodeBanned             = "BANNED"
+	ErrCodeOIDCFailed         = "OIDC_FAILED"
+	ErrCodeIdentityLinked     = "IDENTITY_LINKED"
+	ErrCodePermissionDenied   = "PERMISSION_DENIED"
+	ErrCodeInternal           = "INTERNAL_ERROR"
+)
+
+// ErrorPayload is the ERROR payload for clients on protocol version 2 and later
+type ErrorPayload struct {
+	Code       string          `json:"code"`
+	Message    string          `json:"message"`
+	Permission string          `json:"permission,omitempty"` // What the client lacked, with PERMISSION_DENIED and LOGIN_REQUIRED
+	Request    *RequestSummary `json:"request,omitempty"`    // The client message that caused the error
+}
+
+// RequestSummary identifies the client message an error or reply refers to
+type RequestSummary struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// AckPayload confirms that the request with the given ID succeeded
+type AckPayload struct {
+	ID   string `json:"id"`
+	Type string `json:"type"` // Type of the acknowledged request
+}
+
+// NackPayload reports that the request with the given ID failed
+type NackPayload struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Permission string `json:"permission,omitempty"` // What the client lacked, with PERMISSION_DENIED and LOGIN_REQUIRED
+}
+
+// ReplyMessage builds the ACK or NACK answering req, depending on err
+func ReplyMessage(req *ClientMessage, err error) Message {
+	if err == nil {
+		return Message{Type: MsgAck, Payload: AckPayload{ID: req.ID, Type: req.Type}}
+	}
+	perr := AsProtocolError(err)
+	return Message{Type: MsgNack, Payload: NackPayload{ID: req.ID, Type: req.Type, Code: perr.Code, Message: perr.Message, Permission: perr.Permission}}
+}
+
+// AsProtocolError returns err as a *ProtocolError, treating unknown errors as bad messages
+func AsProtocolError(err error) *ProtocolError {
+	var perr *ProtocolError
+	if !errors.As(err, &perr) {
+		perr = &ProtocolError{Code: ErrCodeBadMessage, Message: err.Error()}
+	}
+	return perr
+}
+
+// ProtocolError is a client-facing failure with a stable code
+type ProtocolError struct {
+	Code       string
+	Message    string
+	Permission string // Set when the client lacked a permission
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Message
+}
+
+// ErrorMessage builds an ERROR message; req may be nil when the error is not
+// a direct reply to a client message
+func ErrorMessage(perr *ProtocolError, req *ClientMessage) Message {
+	payload := ErrorPayload{Code: perr.Code, Message: perr.Message, Permission: perr.Permission}
+	if req != nil {
+		payload.Request = &RequestSummary{Type: req.Type, Payload: req.Payload}
+	}
+	return Message{Type: MsgError, Payload: payload}
+}
+
+// Adapt rewrites msg into the shape the client's protocol version expects.
+// Legacy clients get ERROR payloads as plain text, and clients that agreed on
+// FeatureDeltas get GAME_UPDATE as GAME_DELTA.
+func (c ClientInfo) Adapt(msg Message) Message {
+	if c.Version < 2 {
+		if payload, ok := msg.Payload.(ErrorPayload); ok {
+			msg.Payload = payload.Message
+		}
+	}
+	if c.Has(FeatureDeltas) {
+		if payload, ok := msg.Payload.(GameUpdatePayload); ok {
+			if delta, ok := deltaUpdate(payload); ok {
+				delta.Seq = msg.Seq
+				msg = delta
+			}
+		}
+	}
+	return msg
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/gorilla/websocket"
 
-	"4-in-a-row/analytics"
 	"4-in-a-row/db"
 )
 
@@ -24,9 +23,16 @@ type Game struct {
 	Moves      []db.MoveData
 	MoveNumber int
 	StartTime  time.Time
+	Clock      Clock
+	Events     []db.GameEvent // Ordered log of every state transition
+	Manager    *GameManager
+
+	watchers  map[*watcher]struct{} // Live event feeds, see Watch
+	endReason string                // Why the game ended early, e.g. EndAborted
 }
 
-func NewGame(id string, p1, p2 *Player) *Game {
+func NewGame(id string, p1, p2 *Player, manager *GameManager) *Game {
+	clock := manager.Clock
 	p1.Symbol = 1
 	p2.Symbol = 2
 	return &Game{
@@ -36,14 +42,23 @@ func NewGame(id string, p1, p2 *Player) *Game {
 		Board:      NewBoard(),
 		Turn:       1, // Player 1 starts
 		State:      "active",
-		LastMove:   time.Now(),
+		LastMove:   clock.Now(),
 		Moves:      []db.MoveData{},
 		MoveNumber: 0,
-		StartTime:  time.Now(),
+		StartTime:  clock.Now(),
+		Clock:      clock,
+		Events:     []db.GameEvent{},
+		Manager:    manager,
 	}
 }
 
 func (g *Game) Start() {
+	g.Mutex.Lock()
+	g.record(EventStarted, db.GameEventData{})
+	g.Mutex.Unlock()
+
+	g.setPresence(StatusPlaying)
+
 	g.Player1.SendMessage(Message{
 		Type: MsgGameStart,
 		Payload: GameStartPayload{
@@ -61,7 +76,8 @@ func (g *Game) Start() {
 				Type:     getPlayerType(g.Player2),
 				IsOnline: true,
 			},
-			YourTurn: true,
+			YourTurn:       true,
+			ReconnectToken: g.reconnectToken(g.Player1),
 		},
 	})
 
@@ -84,7 +100,8 @@ func (g *Game) Start() {
 				Type:     getPlayerType(g.Player1),
 				IsOnline: true,
 			},
-			YourTurn: false,
+			YourTurn:       false,
+			ReconnectToken: g.reconnectToken(g.Player2),
 		},
 	})
 
@@ -93,23 +110,23 @@ func (g *Game) Start() {
 	log.Printf("Game %s started: %s vs %s", g.ID, g.Player1.Username, g.Player2.Username)
 }
 
-func (g *Game) HandleMove(player *Player, col int) {
+// HandleMove drops player's disc in col. A rejected move is reported as a
+// *ProtocolError for the caller to pass on to the client.
+func (g *Game) HandleMove(player *Player, col int) error {
 	g.Mutex.Lock()
 	defer g.Mutex.Unlock()
 
 	if g.State != "active" {
-		return
+		return &ProtocolError{Code: ErrCodeGameFinished, Message: "Game is already over"}
 	}
 
 	if player.Symbol != g.Turn {
-		player.SendMessage(Message{Type: MsgError, Payload: "Not your turn"})
-		return
+		return &ProtocolError{Code: ErrCodeNotYourTurn, Message: "Not your turn"}
 	}
 
 	row, err := g.Board.DropDisc(col, g.Turn)
 	if err != nil {
-		player.SendMessage(Message{Type: MsgError, Payload: "Invalid move"})
-		return
+		return &ProtocolError{Code: ErrCodeInvalidMove, Message: "Invalid move: " + err.Error()}
 	}
 
 	g.MoveNumber++
@@ -118,16 +135,17 @@ func (g *Game) HandleMove(player *Player, col int) {
 		Player:     g.Turn,
 		Column:     col,
 		Row:        row,
-		Timestamp:  time.Now().Unix(),
+		Timestamp:  g.Clock.Now().Unix(),
 	}
 	g.Moves = append(g.Moves, moveData)
+	g.record(EventMove, db.GameEventData{Move: &moveData})
 
 	if g.Board.CheckWin(row, col, g.Turn) {
 		g.State = "finished"
 		g.Winner = g.Turn
 		g.BroadcastUpdate(row, col)
 		g.BroadcastGameOver()
-		return
+		return nil
 	}
 
 	if g.Board.IsFull() {
@@ -135,7 +153,7 @@ func (g *Game) HandleMove(player *Player, col int) {
 		g.Winner = 3 // Draw
 		g.BroadcastUpdate(row, col)
 		g.BroadcastGameOver()
-		return
+		return nil
 	}
 
 	if g.Turn == 1 {
@@ -147,27 +165,20 @@ func (g *Game) HandleMove(player *Player, col int) {
 	g.BroadcastUpdate(row, col)
 
 	if g.Turn == 2 && g.Player2.IsBot {
-		go g.TriggerBotMove()
+		g.Clock.AfterFunc(BotMoveDelay, g.TriggerBotMove)
 	}
+	return nil
 }
 
+// BroadcastUpdate sends the position after a move. Clients that agreed on
+// FeatureDeltas receive it as GAME_DELTA (see ClientInfo.Adapt).
 func (g *Game) BroadcastUpdate(lastRow, lastCol int) {
-	var lastMove *LastMove
-	if g.MoveNumber > 0 {
-		lastMoveData := g.Moves[len(g.Moves)-1]
-		lastMove = &LastMove{
-			Player: lastMoveData.Player,
-			Column: lastMoveData.Column,
-			Row:    lastMoveData.Row,
-		}
-	}
-
 	msg := Message{
 		Type: MsgUpdate,
 		Payload: GameUpdatePayload{
 			Grid:        g.Board.Grid,
 			CurrentTurn: g.Turn,
-			LastMove:    lastMove,
+			LastMove:    g.lastMove(),
 			MoveNumber:  g.MoveNumber,
 		},
 	}
@@ -175,31 +186,61 @@ func (g *Game) BroadcastUpdate(lastRow, lastCol int) {
 	g.Player2.SendMessage(msg)
 }
 
+// reconnectToken issues the token that lets p reclaim its seat; bots get none
+func (g *Game) reconnectToken(p *Player) string {
+	if p.IsBot {
+		return ""
+	}
+	token, err := g.Manager.Tokens.IssueReconnect(g.ID, p.ID, g.Clock.Now())
+	if err != nil {
+		log.Printf("Failed to issue reconnect token for %s in game %s: %v", p.Username, g.ID, err)
+	}
+	return token
+}
+
+// setPresence updates both players' lobby status
+func (g *Game) setPresence(status string) {
+	if l := g.Manager.Lobby; l != nil {
+		l.SetStatus(g.Player1, status)
+		l.SetStatus(g.Player2, status)
+	}
+}
+
+// lastMove describes the most recent move, or nil before the first one
+func (g *Game) lastMove() *LastMove {
+	if g.MoveNumber == 0 {
+		return nil
+	}
+	lastMoveData := g.Moves[len(g.Moves)-1]
+	return &LastMove{
+		Player: lastMoveData.Player,
+		Column: lastMoveData.Column,
+		Row:    lastMoveData.Row,
+	}
+}
+
 func (g *Game) BroadcastGameOver() {
-	winnerStr := ""
 	winnerName := ""
+	winnerID := ""
 
 	if g.Winner == 1 {
-		winnerStr = g.Player1.Username
 		winnerName = g.Player1.Username
+		winnerID = g.Player1.UserID
 	} else if g.Winner == 2 {
-		winnerStr = g.Player2.Username
 		winnerName = g.Player2.Username
+		winnerID = g.Player2.UserID
 	} else {
-		winnerStr = "draw"
 		winnerName = "Draw"
 	}
 
-	msg := Message{
-		Type: MsgGameOver,
-		Payload: GameOverPayload{
-			Winner: winnerStr,
-		},
-	}
+	payload := g.gameOverPayload()
+	winnerStr := payload.Winner
+	msg := Message{Type: MsgGameOver, Payload: payload}
 	g.Player1.SendMessage(msg)
 	g.Player2.SendMessage(msg)
+	g.setPresence(StatusIdle)
 
-	duration := int64(time.Since(g.StartTime).Seconds())
+	duration := int64(g.Clock.Since(g.StartTime).Seconds())
 
 	// Log game result
 	if g.Winner == 3 {
@@ -210,38 +251,43 @@ func (g *Game) BroadcastGameOver() {
 			g.ID, winnerName, g.Player1.Username, g.Player2.Username, duration)
 	}
 
+	g.record(EventFinished, db.GameEventData{Winner: g.Winner})
+
 	// Prepare player data
-	p1Data := db.PlayerData{
-		ID:       g.Player1.ID,
-		Username: g.Player1.Username,
-		Symbol:   g.Player1.Symbol,
-		Type:     getPlayerType(g.Player1),
-	}
-	p2Data := db.PlayerData{
-		ID:       g.Player2.ID,
-		Username: g.Player2.Username,
-		Symbol:   g.Player2.Symbol,
-		Type:     getPlayerType(g.Player2),
-	}
+	p1Data := playerData(g.Player1)
+	p2Data := playerData(g.Player2)
 
 	// Persist game result with moves
-	db.SaveGameResult(g.ID, p1Data, p2Data, winnerStr, g.Moves, duration)
+	result := &db.GameResult{
+		GameID:    g.ID,
+		Player1:   p1Data,
+		Player2:   p2Data,
+		Winner:    winnerStr,
+		WinnerID:  winnerID,
+		Moves:     g.Moves,
+		Duration:  duration,
+		CreatedAt: g.Clock.Now(),
+	}
+	if err := g.Manager.Store.SaveGameResult(result); err != nil {
+		log.Printf("Failed to save game result: %v", err)
+	} else {
+		log.Printf("Game result saved: %s won, %d moves recorded", winnerStr, len(g.Moves))
+	}
 
-	// Emit Kafka event
-	analytics.EmitGameEnd(g.ID, winnerStr, duration)
+	// Emit analytics event
+	if err := g.Manager.Stream.PublishGameCompleted(g.ID, winnerStr, duration); err != nil {
+		log.Printf("Failed to publish game end for %s: %v", g.ID, err)
+	}
 
 	// Clean up game after a short delay to allow clients to receive game over message
-	go func() {
-		time.Sleep(5 * time.Second)
-		GameManagerInstance.RemoveGame(g.ID)
+	g.Clock.AfterFunc(GameCleanupDelay, func() {
+		g.Manager.RemoveGame(g.ID)
 		log.Printf("Game %s cleaned up from active games", g.ID)
-	}()
+	})
 }
 
+// TriggerBotMove plays the bot's turn; it is scheduled BotMoveDelay after the human moves
 func (g *Game) TriggerBotMove() {
-	// Realistic delay
-	time.Sleep(500 * time.Millisecond)
-
 	// Use smart bot AI
 	bot := &BotAI{
 		board:          g.Board,
@@ -266,7 +312,9 @@ func (g *Game) HandleDisconnect(player *Player) {
 
 	log.Printf("Player %s disconnected from game %s", player.Username, g.ID)
 	player.IsConnected = false
-	player.DisconnectedAt = time.Now()
+	player.DisconnectedAt = g.Clock.Now()
+	player.Detach()
+	g.record(EventDisconnect, db.GameEventData{Player: player.Symbol})
 
 	// Notify opponent about disconnect
 	opponent := GetOpponent(g, player)
@@ -275,70 +323,115 @@ func (g *Game) HandleDisconnect(player *Player) {
 		Payload: PlayerStatusPayload{
 			PlayerSymbol: player.Symbol,
 			IsOnline:     false,
-			TimeLeft:     30,
+			TimeLeft:     int(ReconnectTimeout.Seconds()),
 		},
 	})
 
-	// Start countdown timer with updates
+	g.startForfeitCountdown(player)
+}
+
+// startForfeitCountdown gives a disconnected player ReconnectTimeout to come
+// back. The forfeit is a timer on the game clock so it happens exactly on
+// time; the ticker only drives the countdown shown to the opponent. Callers
+// must hold g.Mutex.
+func (g *Game) startForfeitCountdown(player *Player) {
+	since := player.DisconnectedAt
+	g.Clock.AfterFunc(ReconnectTimeout, func() {
+		g.forfeit(player, since)
+	})
+
+	ticker := g.Clock.NewTicker(1 * time.Second)
 	go func() {
-		ticker := time.NewTicker(1 * time.Second)
 		defer ticker.Stop()
 
-		startTime := time.Now()
-		for i := 29; i >= 0; i-- {
-			<-ticker.C
-
+		for range ticker.C() {
 			g.Mutex.Lock()
-			if g.State != "active" || player.IsConnected {
+			timeLeft := ReconnectTimeout - g.Clock.Since(since)
+			if !g.awaiting(player, since) || timeLeft <= 0 {
 				g.Mutex.Unlock()
 				return
 			}
 
-			elapsed := int(time.Since(startTime).Seconds())
-			timeLeft := 30 - elapsed
-			if timeLeft < 0 {
-				timeLeft = 0
-			}
-
 			opponent := GetOpponent(g, player)
 			opponent.SendMessage(Message{
 				Type: MsgPlayerStatus,
 				Payload: PlayerStatusPayload{
 					PlayerSymbol: player.Symbol,
 					IsOnline:     false,
-					TimeLeft:     timeLeft,
+					TimeLeft:     int(timeLeft.Round(time.Second).Seconds()),
 				},
 			})
 			g.Mutex.Unlock()
-
-			if timeLeft == 0 {
-				break
-			}
 		}
+	}()
+}
+
+// awaiting reports whether the game is still waiting for a player who
+// disconnected at since; a reconnect, or a later disconnect with its own
+// countdown, ends the wait. Callers must hold g.Mutex.
+func (g *Game) awaiting(player *Player, since time.Time) bool {
+	return g.State == "active" && !player.IsConnected && player.DisconnectedAt.Equal(since)
+}
 
-		// Final check after 30 seconds
-		g.Mutex.Lock()
-		defer g.Mutex.Unlock()
+// forfeit ends the game against a player who did not come back within the
+// reconnect window
+func (g *Game) forfeit(player *Player, since time.Time) {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
 
-		if g.State == "active" && !player.IsConnected {
-			log.Printf("Player %s timed out. Forfeiting game %s.", player.Username, g.ID)
+	if !g.awaiting(player, since) {
+		return
+	}
 
-			g.State = "finished"
+	// Both seats empty since the same moment, as after a restart: nobody
+	// showed up, so nobody wins
+	opponent := GetOpponent(g, player)
+	if !opponent.IsBot && g.awaiting(opponent, since) {
+		log.Printf("Neither player returned to game %s. Ending it without a result.", g.ID)
+		g.State = "finished"
+		g.Winner = 0
+		g.endReason = EndAbandoned
+		g.record(EventAbandoned, db.GameEventData{})
+		g.endWithoutResult()
+		return
+	}
 
-			if player.Symbol == 1 {
-				g.Winner = 2
-			} else {
-				g.Winner = 1
-			}
+	log.Printf("Player %s timed out. Forfeiting game %s.", player.Username, g.ID)
 
-			g.BroadcastGameOver()
+	g.State = "finished"
 
-			GameManagerInstance.RemoveGame(g.ID)
-		}
-	}()
+	if player.Symbol == 1 {
+		g.Winner = 2
+	} else {
+		g.Winner = 1
+	}
+	g.record(EventForfeit, db.GameEventData{Player: player.Symbol, Winner: g.Winner})
+
+	g.BroadcastGameOver()
+
+	g.Manager.RemoveGame(g.ID)
 }
 
-func (g *Game) HandleReconnect(playerID string, conn *websocket.Conn) (*Player, bool) {
+// gameOverPayload describes how the finished game ended: the winner's
+// username, "draw", or no winner for games ended without a result. Callers
+// must hold g.Mutex.
+func (g *Game) gameOverPayload() GameOverPayload {
+	payload := GameOverPayload{Reason: g.endReason}
+	switch g.Winner {
+	case 1:
+		payload.Winner = g.Player1.Username
+	case 2:
+		payload.Winner = g.Player2.Username
+	case 3:
+		payload.Winner = "draw"
+	}
+	return payload
+}
+
+// HandleReconnect attaches a new connection to a player. If lastSeq is still
+// covered by the player's replay buffer, only the missed messages are
+// replayed; otherwise the player gets a full snapshot of the game.
+func (g *Game) HandleReconnect(playerID string, conn *websocket.Conn, client ClientInfo, lastSeq int64) (*Player, bool) {
 	g.Mutex.Lock()
 	defer g.Mutex.Unlock()
 
@@ -355,23 +448,36 @@ func (g *Game) HandleReconnect(playerID string, conn *websocket.Conn) (*Player,
 		return nil, false
 	}
 
-	p.Conn = conn
 	p.IsConnected = true
+	g.record(EventReconnect, db.GameEventData{Player: p.Symbol})
 
 	log.Printf("Player %s reconnected to game %s", p.Username, g.ID)
 
 	opponent := GetOpponent(g, p)
 
 	// Notify opponent about reconnect
+	p.Latency = 0
 	opponent.SendMessage(Message{
-		Type: MsgPlayerStatus,
-		Payload: PlayerStatusPayload{
-			PlayerSymbol: p.Symbol,
-			IsOnline:     true,
-			TimeLeft:     0,
-		},
+		Type:    MsgPlayerStatus,
+		Payload: onlineStatus(p),
 	})
 
+	// Replay what the player missed if we still can, otherwise send a snapshot
+	if replayed, ok := p.Resume(conn, client, lastSeq); ok {
+		log.Printf("Resumed session of %s in game %s: replayed %d messages after #%d", p.Username, g.ID, replayed, lastSeq)
+		p.SendMessage(Message{
+			Type: MsgResumed,
+			Payload: ResumedPayload{
+				GameID:         g.ID,
+				LastSeq:        lastSeq,
+				Replayed:       replayed,
+				ReconnectToken: g.reconnectToken(p),
+			},
+		})
+		return p, true
+	}
+	p.Attach(conn, client)
+
 	reconnectMsg := Message{
 		Type: MsgReconnect,
 		Payload: ReconnectPayload{
@@ -393,31 +499,64 @@ func (g *Game) HandleReconnect(playerID string, conn *websocket.Conn) (*Player,
 			CurrentTurn: g.Turn,
 			YourTurn:    g.Turn == p.Symbol && g.State == "active",
 			MoveNumber:  g.MoveNumber,
+
+			ReconnectToken: g.reconnectToken(p),
 		},
 	}
 	p.SendMessage(reconnectMsg)
 
-	if g.State == "finished" {
-		winnerStr := ""
-		if g.Winner == 1 {
-			winnerStr = g.Player1.Username
-		} else if g.Winner == 2 {
-			winnerStr = g.Player2.Username
-		} else {
-			winnerStr = "draw"
-		}
-
+	// Let the returning player know how the opponent's connection is doing
+	if opponent.IsConnected && opponent.Latency > 0 {
 		p.SendMessage(Message{
-			Type: MsgGameOver,
-			Payload: GameOverPayload{
-				Winner: winnerStr,
-			},
+			Type:    MsgPlayerStatus,
+			Payload: onlineStatus(opponent),
 		})
 	}
 
+	if g.State == "finished" {
+		p.SendMessage(Message{Type: MsgGameOver, Payload: g.gameOverPayload()})
+	}
+
 	return p, true
 }
 
+// UpdateLatency records a heartbeat round trip for p and tells the opponent
+// when p's connection quality changes
+func (g *Game) UpdateLatency(p *Player, rtt time.Duration) {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	before := ""
+	if p.Latency > 0 {
+		before = ConnectionQuality(p.Latency)
+		p.Latency = (3*p.Latency + rtt) / 4
+	} else {
+		p.Latency = rtt
+	}
+
+	if g.State != "active" || ConnectionQuality(p.Latency) == before {
+		return
+	}
+
+	GetOpponent(g, p).SendMessage(Message{
+		Type:    MsgPlayerStatus,
+		Payload: onlineStatus(p),
+	})
+}
+
+// onlineStatus describes a connected player to their opponent
+func onlineStatus(p *Player) PlayerStatusPayload {
+	status := PlayerStatusPayload{
+		PlayerSymbol: p.Symbol,
+		IsOnline:     true,
+	}
+	if p.Latency > 0 {
+		status.LatencyMs = int(p.Latency.Milliseconds())
+		status.Quality = ConnectionQuality(p.Latency)
+	}
+	return status
+}
+
 func GetOpponent(g *Game, p *Player) *Player {
 	if p == g.Player1 {
 		return g.Player2
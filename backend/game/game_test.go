@@ -0,0 +1,115 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestGame starts a game between two connected humans on a fake clock
+func newTestGame(t *testing.T) (*Game, *FakeClock) {
+	t.Helper()
+	clock := NewFakeClock(testStart)
+	gm := NewGameManager(clock, nil, nil)
+	p1 := &Player{ID: "p1", Username: "alice", IsConnected: true}
+	p2 := &Player{ID: "p2", Username: "bob", IsConnected: true}
+	g := NewGame("game-1", p1, p2, gm)
+	gm.AddGame(g)
+	return g, clock
+}
+
+func gameState(g *Game) (string, int) {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+	return g.State, g.Winner
+}
+
+func TestForfeitAfterReconnectTimeout(t *testing.T) {
+	g, clock := newTestGame(t)
+
+	g.HandleDisconnect(g.Player1)
+	clock.Advance(ReconnectTimeout - time.Millisecond)
+	if state, _ := gameState(g); state != "active" {
+		t.Fatalf("state %q just before the reconnect window closed, want active", state)
+	}
+
+	clock.Advance(time.Millisecond)
+	state, winner := gameState(g)
+	if state != "finished" || winner != 2 {
+		t.Fatalf("got state %q winner %d after the reconnect window, want finished with winner 2", state, winner)
+	}
+	if g.Manager.GetGame(g.ID) != nil {
+		t.Error("forfeited game is still registered")
+	}
+}
+
+func TestForfeitInSingleAdvance(t *testing.T) {
+	g, clock := newTestGame(t)
+
+	g.HandleDisconnect(g.Player2)
+	clock.Advance(ReconnectTimeout)
+
+	state, winner := gameState(g)
+	if state != "finished" || winner != 1 {
+		t.Fatalf("got state %q winner %d, want finished with winner 1", state, winner)
+	}
+}
+
+func TestReconnectCancelsForfeit(t *testing.T) {
+	g, clock := newTestGame(t)
+
+	g.HandleDisconnect(g.Player1)
+	clock.Advance(10 * time.Second)
+	if _, ok := g.HandleReconnect(g.Player1.ID, nil, ClientInfo{}, 0); !ok {
+		t.Fatal("reconnect refused")
+	}
+	clock.Advance(2 * ReconnectTimeout)
+
+	if state, _ := gameState(g); state != "active" {
+		t.Fatalf("state %q after the player came back, want active", state)
+	}
+}
+
+func TestSecondDisconnectGetsFullWindow(t *testing.T) {
+	g, clock := newTestGame(t)
+
+	g.HandleDisconnect(g.Player1)
+	clock.Advance(10 * time.Second)
+	g.HandleReconnect(g.Player1.ID, nil, ClientInfo{}, 0)
+	clock.Advance(10 * time.Second)
+	g.HandleDisconnect(g.Player1)
+
+	// The first countdown would have ended here
+	clock.Advance(ReconnectTimeout - 10*time.Second)
+	if state, _ := gameState(g); state != "active" {
+		t.Fatalf("state %q when the first countdown would have expired, want active", state)
+	}
+
+	clock.Advance(10 * time.Second)
+	if state, winner := gameState(g); state != "finished" || winner != 2 {
+		t.Fatalf("got state %q winner %d, want finished with winner 2", state, winner)
+	}
+}
+
+func TestReconnectAfterAbortWithoutResult(t *testing.T) {
+	g, _ := newTestGame(t)
+
+	g.HandleDisconnect(g.Player1)
+	if err := g.Abort(0); err != nil {
+		t.Fatal(err)
+	}
+	p, ok := g.HandleReconnect(g.Player1.ID, nil, ClientInfo{}, 0)
+	if !ok {
+		t.Fatal("reconnect to the finished game refused")
+	}
+
+	last := p.replay[len(p.replay)-1]
+	over, isOver := last.Payload.(GameOverPayload)
+	if last.Type != MsgGameOver || !isOver {
+		t.Fatalf("last message is %s, want %s", last.Type, MsgGameOver)
+	}
+	if over.Winner != "" || over.Reason != EndAborted {
+		t.Errorf("got winner %q reason %q, want no winner and reason %q", over.Winner, over.Reason, EndAborted)
+	}
+}
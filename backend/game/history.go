@@ -0,0 +1,216 @@
+package game
+
+import (
+	"fmt"
+	"log"
+
+	"4-in-a-row/db"
+)
+
+// Game event types, in the order they usually appear in a game's log
+const (
+	EventCreated    = "created"
+	EventStarted    = "started"
+	EventMove       = "move"
+	EventDisconnect = "disconnect"
+	EventReconnect  = "reconnect"
+	EventForfeit    = "forfeit"
+	EventAborted    = "aborted"   // An operator ended the game; Winner is 0 for no result
+	EventAbandoned  = "abandoned" // Neither player came back to a recovered game; no result
+	EventFinished   = "finished"
+)
+
+// record appends an event to the game's log and persists it. Callers must
+// hold g.Mutex (or own the game before it is shared).
+func (g *Game) record(eventType string, data db.GameEventData) {
+	event := db.GameEvent{
+		GameID:    g.ID,
+		Seq:       len(g.Events) + 1,
+		Type:      eventType,
+		Data:      data,
+		CreatedAt: g.Clock.Now(),
+	}
+	g.Events = append(g.Events, event)
+	if err := g.Manager.Store.AppendGameEvent(event); err != nil {
+		log.Printf("Failed to save event %s #%d for game %s: %v", event.Type, event.Seq, event.GameID, err)
+	}
+	g.notifyWatchers(event)
+}
+
+// RebuildGame replays an event log into a Game. Rebuilt players have no
+// connection; the returned game is not registered with the manager.
+func RebuildGame(events []db.GameEvent, manager *GameManager) (*Game, error) {
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no events to rebuild from")
+	}
+
+	first := events[0]
+	if first.Type != EventCreated || first.Data.Player1 == nil || first.Data.Player2 == nil {
+		return nil, fmt.Errorf("game %s: log does not start with a %s event", first.GameID, EventCreated)
+	}
+
+	p1 := playerFromData(*first.Data.Player1)
+	p2 := playerFromData(*first.Data.Player2)
+	g := NewGame(first.GameID, p1, p2, manager)
+	g.StartTime = first.CreatedAt
+	g.LastMove = first.CreatedAt
+
+	for i, event := range events {
+		if event.GameID != g.ID {
+			return nil, fmt.Errorf("game %s: event #%d belongs to game %s", g.ID, event.Seq, event.GameID)
+		}
+		if event.Seq != i+1 {
+			return nil, fmt.Errorf("game %s: expected event #%d, got #%d", g.ID, i+1, event.Seq)
+		}
+		if err := g.apply(event); err != nil {
+			return nil, fmt.Errorf("game %s: event #%d (%s): %w", g.ID, event.Seq, event.Type, err)
+		}
+		g.Events = append(g.Events, event)
+	}
+
+	return g, nil
+}
+
+// apply mutates the game state as described by a single event
+func (g *Game) apply(event db.GameEvent) error {
+	switch event.Type {
+	case EventCreated:
+		return nil
+
+	case EventStarted:
+		g.Player1.IsConnected = true
+		g.Player2.IsConnected = true
+
+	case EventMove:
+		move := event.Data.Move
+		if move == nil {
+			return fmt.Errorf("missing move")
+		}
+		if g.State != "active" {
+			return fmt.Errorf("move after game ended")
+		}
+		if move.Player != g.Turn {
+			return fmt.Errorf("player %d moved out of turn", move.Player)
+		}
+		row, err := g.Board.DropDisc(move.Column, move.Player)
+		if err != nil {
+			return err
+		}
+		if row != move.Row {
+			return fmt.Errorf("disc landed on row %d, log says %d", row, move.Row)
+		}
+		g.MoveNumber = move.MoveNumber
+		g.Moves = append(g.Moves, *move)
+		g.LastMove = event.CreatedAt
+		if g.Turn == 1 {
+			g.Turn = 2
+		} else {
+			g.Turn = 1
+		}
+
+	case EventDisconnect, EventReconnect:
+		p := g.playerBySymbol(event.Data.Player)
+		if p == nil {
+			return fmt.Errorf("unknown player %d", event.Data.Player)
+		}
+		p.IsConnected = event.Type == EventReconnect
+		if !p.IsConnected {
+			p.DisconnectedAt = event.CreatedAt
+		}
+
+	case EventForfeit, EventAborted, EventAbandoned, EventFinished:
+		g.State = "finished"
+		g.Winner = event.Data.Winner
+		switch event.Type {
+		case EventAborted:
+			g.endReason = EndAborted
+		case EventAbandoned:
+			g.endReason = EndAbandoned
+		}
+
+	default:
+		return fmt.Errorf("unknown event type")
+	}
+
+	return nil
+}
+
+// LoadGame rebuilds a game from its persisted event log
+func (gm *GameManager) LoadGame(gameID string) (*Game, error) {
+	events, err := gm.Store.GetGameEvents(gameID)
+	if err != nil {
+		return nil, err
+	}
+	return RebuildGame(events, gm)
+}
+
+// RecoverGames restores games that were still running when the server
+// stopped. Their players start out disconnected and share one reconnect
+// window: a player who is still missing when it closes forfeits, and the
+// game ends without a result if both are.
+func (gm *GameManager) RecoverGames() {
+	ids, err := gm.Store.GetUnfinishedGameIDs()
+	if err != nil {
+		log.Printf("Failed to look up unfinished games: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		g, err := gm.LoadGame(id)
+		if err != nil {
+			log.Printf("Failed to rebuild game %s: %v", id, err)
+			continue
+		}
+		if g.State != "active" {
+			continue
+		}
+
+		gm.AddGame(g)
+		log.Printf("Recovered game %s (%s vs %s, %d moves)", g.ID, g.Player1.Username, g.Player2.Username, g.MoveNumber)
+
+		g.Mutex.Lock()
+		now := g.Clock.Now()
+		for _, p := range []*Player{g.Player1, g.Player2} {
+			if p.IsBot {
+				continue
+			}
+			p.IsConnected = false
+			p.DisconnectedAt = now
+			g.record(EventDisconnect, db.GameEventData{Player: p.Symbol})
+			g.startForfeitCountdown(p)
+		}
+		if g.Player2.IsBot && g.Turn == 2 {
+			g.Clock.AfterFunc(BotMoveDelay, g.TriggerBotMove)
+		}
+		g.Mutex.Unlock()
+	}
+}
+
+func (g *Game) playerBySymbol(symbol int) *Player {
+	switch symbol {
+	case 1:
+		return g.Player1
+	case 2:
+		return g.Player2
+	}
+	return nil
+}
+
+func playerData(p *Player) db.PlayerData {
+	return db.PlayerData{
+		ID:       p.ID,
+		UserID:   p.UserID,
+		Username: p.Username,
+		Symbol:   p.Symbol,
+		Type:     getPlayerType(p),
+	}
+}
+
+func playerFromData(d db.PlayerData) *Player {
+	return &Player{
+		ID:       d.ID,
+		UserID:   d.UserID,
+		Username: d.Username,
+		IsBot:    d.Type == "bot",
+	}
+}
@@ -0,0 +1,58 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"4-in-a-row/db"
+)
+
+// recoverTestGame saves the log of a game cut off by a restart and recovers
+// it on a fresh manager sharing the store
+func recoverTestGame(t *testing.T) (*GameManager, *FakeClock, string) {
+	t.Helper()
+	store := db.NewMemoryStore()
+
+	before := NewGameManager(NewFakeClock(testStart), store, nil)
+	g := NewGame("game-1", &Player{ID: "p1", Username: "alice"}, &Player{ID: "p2", Username: "bob"}, before)
+	p1, p2 := playerData(g.Player1), playerData(g.Player2)
+	g.record(EventCreated, db.GameEventData{Player1: &p1, Player2: &p2})
+	g.record(EventStarted, db.GameEventData{})
+
+	clock := NewFakeClock(testStart.Add(time.Minute))
+	gm := NewGameManager(clock, store, nil)
+	gm.RecoverGames()
+	if gm.GetGame(g.ID) == nil {
+		t.Fatal("game was not recovered")
+	}
+	return gm, clock, g.ID
+}
+
+func TestRecoveredGameWithoutPlayersHasNoResult(t *testing.T) {
+	gm, clock, id := recoverTestGame(t)
+	g := gm.GetGame(id)
+
+	clock.Advance(ReconnectTimeout)
+
+	g.Mutex.Lock()
+	state, winner, reason := g.State, g.Winner, g.endReason
+	g.Mutex.Unlock()
+	if state != "finished" || winner != 0 || reason != EndAbandoned {
+		t.Fatalf("got state %q winner %d reason %q, want finished without a winner, %q", state, winner, reason, EndAbandoned)
+	}
+}
+
+func TestRecoveredGameForfeitedByMissingPlayer(t *testing.T) {
+	gm, clock, id := recoverTestGame(t)
+	g := gm.GetGame(id)
+
+	clock.Advance(ReconnectTimeout / 2)
+	if _, ok := g.HandleReconnect("p2", nil, ClientInfo{}, 0); !ok {
+		t.Fatal("reconnect refused")
+	}
+	clock.Advance(ReconnectTimeout / 2)
+
+	if state, winner := gameState(g); state != "finished" || winner != 2 {
+		t.Fatalf("got state %q winner %d, want finished with winner 2", state, winner)
+	}
+}
@@ -0,0 +1,492 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Presence of a lobby member
+const (
+	StatusIdle    = "idle"
+	StatusQueued  = "queued"
+	StatusPlaying = "playing"
+)
+
+// Challenge options the server can honour
+var (
+	SupportedRules        = []string{"standard"}
+	SupportedTimeControls = []string{"untimed"}
+)
+
+// Reasons sent in CHALLENGE_REMOVED
+const (
+	ChallengeAccepted  = "accepted"
+	ChallengeCancelled = "cancelled"
+	ChallengeDeclined  = "declined"  // The friend turned a direct challenge down
+	ChallengeWithdrawn = "withdrawn" // A player left the lobby or started another game
+)
+
+type LobbySubscribePayload struct {
+	Username string `json:"username"`
+}
+
+// ChallengeRequest is the CHALLENGE_POST payload
+type ChallengeRequest struct {
+	Rules       string `json:"rules"`
+	TimeControl string `json:"timeControl"`
+	Rated       bool   `json:"rated"`
+}
+
+// DirectChallengeRequest is the CHALLENGE payload, challenging one friend
+// instead of the whole lobby
+type DirectChallengeRequest struct {
+	UserID      string `json:"userId"` // Account ID of the friend
+	Rules       string `json:"rules"`
+	TimeControl string `json:"timeControl"`
+	Rated       bool   `json:"rated"`
+}
+
+// ChallengeRef names a challenge in CHALLENGE_CANCEL, CHALLENGE_ACCEPT and
+// CHALLENGE_DECLINE
+type ChallengeRef struct {
+	ChallengeID string `json:"challengeId"`
+}
+
+// ChallengeInfo is an open challenge as shown on the board, or a direct
+// challenge as sent to its creator and opponent
+type ChallengeInfo struct {
+	ChallengeID string `json:"challengeId"`
+	Creator     string `json:"creator"`
+	Opponent    string `json:"opponent,omitempty"` // Set on direct challenges
+	Rules       string `json:"rules"`
+	TimeControl string `json:"timeControl"`
+	Rated       bool   `json:"rated"`
+}
+
+type LobbyMember struct {
+	Username string `json:"username"`
+	Status   string `json:"status"`
+}
+
+// LobbyStatePayload is the LOBBY_STATE snapshot sent on subscribe
+type LobbyStatePayload struct {
+	Members    []LobbyMember   `json:"members"`
+	Challenges []ChallengeInfo `json:"challenges"`
+}
+
+// LobbyPresencePayload is pushed whenever a member joins, leaves or changes status
+type LobbyPresencePayload struct {
+	Username string `json:"username"`
+	Status   string `json:"status,omitempty"`
+	Online   bool   `json:"online"`
+}
+
+type ChallengeRemovedPayload struct {
+	ChallengeID string `json:"challengeId"`
+	Reason      string `json:"reason"`
+}
+
+// delivery is a message queued while a lock was held, to be sent after
+// unlocking
+type delivery struct {
+	to  *Player
+	msg Message
+}
+
+type challenge struct {
+	info    ChallengeInfo
+	creator *Player
+	target  *Player // Only player who may accept; nil for open challenges
+}
+
+// Lobby lets subscribed players see each other and start games through open
+// or direct challenges instead of the matchmaking queue
+type Lobby struct {
+	mu         sync.Mutex
+	matchmaker *Matchmaker
+	members    map[*Player]string // Member -> status
+	challenges map[string]*challenge
+	outbox     []delivery // Sent by unlock, so no socket write holds l.mu
+}
+
+// NewLobby creates the lobby for a matchmaker's games and registers it with
+// the game manager so games can report presence changes
+func NewLobby(matchmaker *Matchmaker) *Lobby {
+	l := &Lobby{
+		matchmaker: matchmaker,
+		members:    make(map[*Player]string),
+		challenges: make(map[string]*challenge),
+	}
+	matchmaker.Manager.Lobby = l
+	return l
+}
+
+// IsMember reports whether p is subscribed to the lobby
+func (l *Lobby) IsMember(p *Player) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.members[p]
+	return ok
+}
+
+// IsUsernameTaken reports whether a member already uses username
+func (l *Lobby) IsUsernameTaken(username string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.memberByUsername(username) != nil
+}
+
+// Join subscribes p and sends it the current members and challenges
+func (l *Lobby) Join(p *Player, status string) {
+	l.mu.Lock()
+	defer l.unlock()
+
+	if _, ok := l.members[p]; ok {
+		return
+	}
+	l.members[p] = status
+	log.Printf("Player %s joined the lobby. Members: %d", p.Username, len(l.members))
+
+	state := LobbyStatePayload{
+		Members:    make([]LobbyMember, 0, len(l.members)),
+		Challenges: make([]ChallengeInfo, 0, len(l.challenges)),
+	}
+	for m, s := range l.members {
+		state.Members = append(state.Members, LobbyMember{Username: m.Username, Status: s})
+	}
+	for _, c := range l.challenges {
+		if c.target == nil {
+			state.Challenges = append(state.Challenges, c.info)
+		}
+	}
+	sort.Slice(state.Members, func(i, j int) bool { return state.Members[i].Username < state.Members[j].Username })
+	sort.Slice(state.Challenges, func(i, j int) bool { return state.Challenges[i].ChallengeID < state.Challenges[j].ChallengeID })
+	l.send(p, Message{Type: MsgLobbyState, Payload: state})
+
+	l.broadcast(p, Message{Type: MsgLobbyPresence, Payload: LobbyPresencePayload{Username: p.Username, Status: status, Online: true}})
+}
+
+// StatusOf returns the status of the member logged in as userID
+func (l *Lobby) StatusOf(userID string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m := l.memberByUserID(userID)
+	if m == nil {
+		return "", false
+	}
+	return l.members[m], true
+}
+
+// Leave unsubscribes p and withdraws its challenges
+func (l *Lobby) Leave(p *Player) bool {
+	l.mu.Lock()
+	defer l.unlock()
+
+	if _, ok := l.members[p]; !ok {
+		return false
+	}
+	l.withdraw(p, ChallengeWithdrawn)
+	delete(l.members, p)
+	log.Printf("Player %s left the lobby. Members: %d", p.Username, len(l.members))
+
+	l.broadcast(nil, Message{Type: MsgLobbyPresence, Payload: LobbyPresencePayload{Username: p.Username, Online: false}})
+	return true
+}
+
+// SetStatus records a member's new status and pushes it to the lobby. A
+// member who is no longer idle withdraws its challenges. Non-members are
+// ignored.
+func (l *Lobby) SetStatus(p *Player, status string) {
+	l.mu.Lock()
+	defer l.unlock()
+	l.setStatus(p, status)
+}
+
+// setStatus is SetStatus for callers that hold l.mu
+func (l *Lobby) setStatus(p *Player, status string) {
+	old, ok := l.members[p]
+	if !ok || old == status {
+		return
+	}
+	l.members[p] = status
+	if status != StatusIdle {
+		l.withdraw(p, ChallengeWithdrawn)
+	}
+
+	l.broadcast(nil, Message{Type: MsgLobbyPresence, Payload: LobbyPresencePayload{Username: p.Username, Status: status, Online: true}})
+}
+
+// PostChallenge opens a challenge by p; each member can have one at a time
+func (l *Lobby) PostChallenge(p *Player, req ChallengeRequest) (ChallengeInfo, error) {
+	if err := req.validate(); err != nil {
+		return ChallengeInfo{}, err
+	}
+
+	l.mu.Lock()
+	defer l.unlock()
+
+	status, ok := l.members[p]
+	if !ok {
+		return ChallengeInfo{}, &ProtocolError{Code: ErrCodeNotInLobby, Message: "Subscribe to the lobby first"}
+	}
+	if status != StatusIdle {
+		return ChallengeInfo{}, &ProtocolError{Code: ErrCodePlayerBusy, Message: "You can only post a challenge while idle"}
+	}
+	if l.openChallengeBy(p) != nil {
+		return ChallengeInfo{}, &ProtocolError{Code: ErrCodeInvalidChallenge, Message: "You already have an open challenge"}
+	}
+
+	c := &challenge{
+		info: ChallengeInfo{
+			ChallengeID: uuid.New().String(),
+			Creator:     p.Username,
+			Rules:       req.Rules,
+			TimeControl: req.TimeControl,
+			Rated:       req.Rated,
+		},
+		creator: p,
+	}
+	l.challenges[c.info.ChallengeID] = c
+	log.Printf("Player %s posted challenge %s", p.Username, c.info.ChallengeID)
+
+	l.broadcast(nil, Message{Type: MsgChallengePosted, Payload: c.info})
+	return c.info, nil
+}
+
+// ChallengeFriend sends a challenge that only the member logged in as
+// friendID can accept. Callers check that the two are friends.
+func (l *Lobby) ChallengeFriend(p *Player, req DirectChallengeRequest) (ChallengeInfo, error) {
+	opts := ChallengeRequest{Rules: req.Rules, TimeControl: req.TimeControl, Rated: req.Rated}
+	if err := opts.validate(); err != nil {
+		return ChallengeInfo{}, err
+	}
+	// Blocks are looked up in the store, so not while holding l.mu
+	if l.matchmaker.Manager.Blocked(p.UserID, req.UserID) {
+		return ChallengeInfo{}, &ProtocolError{Code: ErrCodeBlocked, Message: "You cannot challenge this player"}
+	}
+
+	l.mu.Lock()
+	defer l.unlock()
+
+	status, ok := l.members[p]
+	if !ok {
+		return ChallengeInfo{}, &ProtocolError{Code: ErrCodeNotInLobby, Message: "Subscribe to the lobby first"}
+	}
+	if status != StatusIdle {
+		return ChallengeInfo{}, &ProtocolError{Code: ErrCodePlayerBusy, Message: "You can only challenge a friend while idle"}
+	}
+
+	target := l.memberByUserID(req.UserID)
+	switch {
+	case target == nil:
+		return ChallengeInfo{}, &ProtocolError{Code: ErrCodeFriendUnavailable, Message: "Your friend is not in the lobby"}
+	case target == p:
+		return ChallengeInfo{}, &ProtocolError{Code: ErrCodeInvalidChallenge, Message: "You cannot challenge yourself"}
+	case l.members[target] != StatusIdle:
+		return ChallengeInfo{}, &ProtocolError{Code: ErrCodePlayerBusy, Message: "Your friend is busy"}
+	}
+	for _, c := range l.challenges {
+		if c.creator == p && c.target == target {
+			return ChallengeInfo{}, &ProtocolError{Code: ErrCodeInvalidChallenge, Message: "You already challenged that friend"}
+		}
+	}
+
+	c := &challenge{
+		info: ChallengeInfo{
+			ChallengeID: uuid.New().String(),
+			Creator:     p.Username,
+			Opponent:    target.Username,
+			Rules:       opts.Rules,
+			TimeControl: opts.TimeControl,
+			Rated:       opts.Rated,
+		},
+		creator: p,
+		target:  target,
+	}
+	l.challenges[c.info.ChallengeID] = c
+	log.Printf("Player %s challenged %s (%s)", p.Username, target.Username, c.info.ChallengeID)
+
+	l.send(target, Message{Type: MsgChallengeReceived, Payload: c.info})
+	l.send(p, Message{Type: MsgChallengeSent, Payload: c.info})
+	return c.info, nil
+}
+
+// CancelChallenge withdraws p's own challenge
+func (l *Lobby) CancelChallenge(p *Player, id string) error {
+	l.mu.Lock()
+	defer l.unlock()
+
+	c, ok := l.challenges[id]
+	if !ok || c.creator != p {
+		return &ProtocolError{Code: ErrCodeChallengeNotFound, Message: "You have no open challenge with that ID"}
+	}
+	l.remove(c, ChallengeCancelled)
+	return nil
+}
+
+// AcceptChallenge starts a game between the challenge's creator and p
+func (l *Lobby) AcceptChallenge(p *Player, id string) error {
+	// Blocks are looked up in the store, so not while holding l.mu
+	l.mu.Lock()
+	var creator *Player
+	if c, ok := l.challenges[id]; ok && (c.target == nil || c.target == p) {
+		creator = c.creator
+	}
+	l.mu.Unlock()
+	if creator != nil && l.matchmaker.Manager.Blocked(creator.UserID, p.UserID) {
+		return &ProtocolError{Code: ErrCodeBlocked, Message: "You cannot play this player"}
+	}
+
+	l.mu.Lock()
+
+	c, ok := l.challenges[id]
+	if !ok || (c.target != nil && c.target != p) {
+		l.unlock()
+		return &ProtocolError{Code: ErrCodeChallengeNotFound, Message: "Challenge not found or no longer open"}
+	}
+	status, member := l.members[p]
+	switch {
+	case !member:
+		l.unlock()
+		return &ProtocolError{Code: ErrCodeNotInLobby, Message: "Subscribe to the lobby first"}
+	case c.creator == p:
+		l.unlock()
+		return &ProtocolError{Code: ErrCodeInvalidChallenge, Message: "You cannot accept your own challenge"}
+	case status != StatusIdle:
+		l.unlock()
+		return &ProtocolError{Code: ErrCodePlayerBusy, Message: "You can only accept a challenge while idle"}
+	}
+
+	// Both are playing from now on, so neither can take up another challenge
+	// before the game has started
+	l.remove(c, ChallengeAccepted)
+	l.setStatus(c.creator, StatusPlaying)
+	l.setStatus(p, StatusPlaying)
+	l.unlock()
+
+	log.Printf("Player %s accepted challenge %s from %s", p.Username, id, c.creator.Username)
+	l.matchmaker.StartGame(c.creator, p)
+	return nil
+}
+
+// DeclineChallenge turns down a direct challenge sent to p
+func (l *Lobby) DeclineChallenge(p *Player, id string) error {
+	l.mu.Lock()
+	defer l.unlock()
+
+	c, ok := l.challenges[id]
+	if !ok || c.target != p {
+		return &ProtocolError{Code: ErrCodeChallengeNotFound, Message: "You have no challenge with that ID"}
+	}
+	l.remove(c, ChallengeDeclined)
+	return nil
+}
+
+// withdraw removes the challenges p created or was sent. Callers must hold
+// l.mu.
+func (l *Lobby) withdraw(p *Player, reason string) {
+	for _, c := range l.challenges {
+		if c.creator == p || c.target == p {
+			l.remove(c, reason)
+		}
+	}
+}
+
+// remove takes a challenge off the board, or tells the two players of a
+// direct challenge it is gone. Callers must hold l.mu.
+func (l *Lobby) remove(c *challenge, reason string) {
+	delete(l.challenges, c.info.ChallengeID)
+	msg := Message{Type: MsgChallengeRemoved, Payload: ChallengeRemovedPayload{ChallengeID: c.info.ChallengeID, Reason: reason}}
+	if c.target == nil {
+		l.broadcast(nil, msg)
+		return
+	}
+	l.send(c.creator, msg)
+	l.send(c.target, msg)
+}
+
+func (l *Lobby) openChallengeBy(p *Player) *challenge {
+	for _, c := range l.challenges {
+		if c.creator == p && c.target == nil {
+			return c
+		}
+	}
+	return nil
+}
+
+func (l *Lobby) memberByUsername(username string) *Player {
+	for m := range l.members {
+		if m.Username == username {
+			return m
+		}
+	}
+	return nil
+}
+
+func (l *Lobby) memberByUserID(userID string) *Player {
+	if userID == "" {
+		return nil
+	}
+	for m := range l.members {
+		if m.UserID == userID {
+			return m
+		}
+	}
+	return nil
+}
+
+// broadcast sends msg to every member except skip. Callers must hold l.mu.
+func (l *Lobby) broadcast(skip *Player, msg Message) {
+	for m := range l.members {
+		if m != skip {
+			l.send(m, msg)
+		}
+	}
+}
+
+// send queues msg for p until l.mu is released. Callers must hold l.mu.
+func (l *Lobby) send(p *Player, msg Message) {
+	l.outbox = append(l.outbox, delivery{to: p, msg: msg})
+}
+
+// unlock releases l.mu, then sends the messages queued while it was held
+func (l *Lobby) unlock() {
+	out := l.outbox
+	l.outbox = nil
+	l.mu.Unlock()
+	for _, d := range out {
+		d.to.SendMessage(d.msg)
+	}
+}
+
+// validate fills in the default options and rejects ones the server cannot
+// honour
+func (req *ChallengeRequest) validate() error {
+	if req.Rules == "" {
+		req.Rules = SupportedRules[0]
+	}
+	if req.TimeControl == "" {
+		req.TimeControl = SupportedTimeControls[0]
+	}
+	if !contains(SupportedRules, req.Rules) {
+		return &ProtocolError{Code: ErrCodeInvalidChallenge, Message: fmt.Sprintf("Unsupported rules %q", req.Rules)}
+	}
+	if !contains(SupportedTimeControls, req.TimeControl) {
+		return &ProtocolError{Code: ErrCodeInvalidChallenge, Message: fmt.Sprintf("Unsupported time control %q", req.TimeControl)}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
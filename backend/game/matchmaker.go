@@ -1,20 +1,43 @@
 package game
 
 import (
+	"crypto/rand"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+
+	"4-in-a-row/analytics"
+	"4-in-a-row/auth"
+	"4-in-a-row/db"
 )
 
 type Matchmaker struct {
-	Queue []*Player
-	Mutex sync.Mutex
+	Queue   []*Player
+	Mutex   sync.Mutex
+	Clock   Clock
+	Manager *GameManager
+
+	waiting map[*Player]*queueEntry
+	outbox  []delivery // Sent by unlock, so no socket write holds m.Mutex
 }
 
-var GlobalMatchmaker = &Matchmaker{
-	Queue: make([]*Player, 0),
+// queueEntry tracks the timers of a player waiting in the queue
+type queueEntry struct {
+	joinedAt time.Time
+	fallback Timer // Starts a bot game after MatchTimeout
+	status   Timer // Next periodic QUEUE_STATUS
+}
+
+// NewMatchmaker creates a matchmaker that starts its games on the given manager
+func NewMatchmaker(manager *GameManager) *Matchmaker {
+	return &Matchmaker{
+		Queue:   make([]*Player, 0),
+		Clock:   manager.Clock,
+		Manager: manager,
+		waiting: make(map[*Player]*queueEntry),
+	}
 }
 
 func (m *Matchmaker) IsPlayerInQueue(username string) bool {
@@ -30,13 +53,15 @@ func (m *Matchmaker) IsPlayerInQueue(username string) bool {
 
 func (m *Matchmaker) RemovePlayer(player *Player) bool {
 	m.Mutex.Lock()
-	defer m.Mutex.Unlock()
+	defer m.unlock()
 
 	for i, p := range m.Queue {
 		if p == player || p.ID == player.ID {
 			// Remove player from queue
 			m.Queue = append(m.Queue[:i], m.Queue[i+1:]...)
+			m.forget(p)
 			log.Printf("Player %s removed from queue. Queue size: %d", player.Username, len(m.Queue))
+			m.broadcastStatus()
 			return true
 		}
 	}
@@ -44,27 +69,155 @@ func (m *Matchmaker) RemovePlayer(player *Player) bool {
 }
 
 func (m *Matchmaker) AddPlayer(p *Player) {
+	// Blocks are looked up in the store, so the queue is checked against p
+	// without holding the lock; anyone who joined meanwhile is checked on the
+	// next pass
+	blocked := make(map[*Player]bool)
 	m.Mutex.Lock()
-	defer m.Mutex.Unlock()
+	for {
+		var unchecked []*Player
+		for _, opponent := range m.Queue {
+			if _, ok := blocked[opponent]; !ok {
+				unchecked = append(unchecked, opponent)
+			}
+		}
+		if len(unchecked) == 0 {
+			break
+		}
+		m.Mutex.Unlock()
+		for _, opponent := range unchecked {
+			blocked[opponent] = m.Manager.Blocked(opponent.UserID, p.UserID)
+		}
+		m.Mutex.Lock()
+	}
+	defer m.unlock()
 
 	m.Queue = append(m.Queue, p)
+	m.waiting[p] = &queueEntry{joinedAt: m.Clock.Now()}
 	log.Printf("Player %s added to queue. Queue size: %d", p.Username, len(m.Queue))
 
-	if len(m.Queue) >= 2 {
-		p1 := m.Queue[0]
-		p2 := m.Queue[1]
-		m.Queue = m.Queue[2:]
-		m.StartGame(p1, p2)
-	} else {
-		go m.WaitForMatch(p)
+	// Everyone already waiting has blocked everyone else waiting, so only the
+	// newcomer can make a pair: with the longest-waiting player they have not
+	// blocked
+	for i, opponent := range m.Queue[:len(m.Queue)-1] {
+		if blocked[opponent] {
+			continue
+		}
+		m.Queue = append(m.Queue[:i], m.Queue[i+1:len(m.Queue)-1]...)
+		m.forget(opponent)
+		m.forget(p)
+		m.StartGame(opponent, p)
+		m.broadcastStatus()
+		return
 	}
+
+	m.WaitForMatch(p)
+	m.sendStatus(p)
 }
 
+// WaitForMatch schedules a bot game for p if nobody joins within MatchTimeout
 func (m *Matchmaker) WaitForMatch(p *Player) {
-	time.Sleep(10 * time.Second)
+	entry := m.waiting[p]
+	if entry == nil {
+		return
+	}
+	entry.fallback = m.Clock.AfterFunc(MatchTimeout, func() {
+		m.matchTimeout(p)
+	})
+}
 
+// QueueStatus describes p's place in the queue; ok is false if p is not waiting
+func (m *Matchmaker) QueueStatus(p *Player) (QueueStatusPayload, bool) {
 	m.Mutex.Lock()
 	defer m.Mutex.Unlock()
+	return m.status(p)
+}
+
+func (m *Matchmaker) status(p *Player) (QueueStatusPayload, bool) {
+	entry := m.waiting[p]
+	if entry == nil {
+		return QueueStatusPayload{}, false
+	}
+
+	position := 0
+	for i, qp := range m.Queue {
+		if qp == p {
+			position = i + 1
+			break
+		}
+	}
+
+	elapsed := m.Clock.Since(entry.joinedAt)
+	fallbackIn := MatchTimeout - elapsed
+	if fallbackIn < 0 {
+		fallbackIn = 0
+	}
+
+	return QueueStatusPayload{
+		InQueue:        true,
+		Position:       position,
+		PlayersWaiting: len(m.Queue),
+		ElapsedSeconds: int(elapsed.Seconds()),
+		BotFallbackIn:  int(fallbackIn.Round(time.Second).Seconds()),
+	}, true
+}
+
+// sendStatus queues p its QUEUE_STATUS and schedules the next periodic one.
+// Callers must hold m.Mutex.
+func (m *Matchmaker) sendStatus(p *Player) {
+	status, ok := m.status(p)
+	if !ok {
+		return
+	}
+	m.outbox = append(m.outbox, delivery{to: p, msg: Message{Type: MsgQueueStatus, Payload: status}})
+
+	entry := m.waiting[p]
+	if entry.status != nil {
+		entry.status.Stop()
+	}
+	entry.status = m.Clock.AfterFunc(QueueStatusInterval, func() {
+		m.Mutex.Lock()
+		defer m.unlock()
+		m.sendStatus(p)
+	})
+}
+
+// broadcastStatus pushes fresh QUEUE_STATUS to everyone still waiting after
+// the queue changed. Callers must hold m.Mutex.
+func (m *Matchmaker) broadcastStatus() {
+	for _, p := range m.Queue {
+		m.sendStatus(p)
+	}
+}
+
+// unlock releases m.Mutex, then sends the messages queued while it was held
+func (m *Matchmaker) unlock() {
+	out := m.outbox
+	m.outbox = nil
+	m.Mutex.Unlock()
+	for _, d := range out {
+		d.to.SendMessage(d.msg)
+	}
+}
+
+// forget stops p's queue timers. Callers must hold m.Mutex.
+func (m *Matchmaker) forget(p *Player) {
+	entry := m.waiting[p]
+	if entry == nil {
+		return
+	}
+	if entry.fallback != nil {
+		entry.fallback.Stop()
+	}
+	if entry.status != nil {
+		entry.status.Stop()
+	}
+	delete(m.waiting, p)
+}
+
+func (m *Matchmaker) matchTimeout(p *Player) {
+	m.Mutex.Lock()
+	defer m.unlock()
 
 	found := false
 	for i, qp := range m.Queue {
@@ -76,6 +229,7 @@ func (m *Matchmaker) WaitForMatch(p *Player) {
 	}
 
 	if found {
+		m.forget(p)
 		log.Printf("Timeout for player %s. Starting bot game.", p.Username)
 		bot := &Player{
 			ID:       "bot-" + uuid.New().String(),
@@ -83,16 +237,21 @@ func (m *Matchmaker) WaitForMatch(p *Player) {
 			IsBot:    true,
 		}
 		m.StartGame(p, bot)
+		m.broadcastStatus()
 	}
 }
 
 func (m *Matchmaker) StartGame(p1, p2 *Player) {
 	gameID := uuid.New().String()
-	game := NewGame(gameID, p1, p2)
+	game := NewGame(gameID, p1, p2, m.Manager)
+
+	p1Data := playerData(p1)
+	p2Data := playerData(p2)
+	game.record(EventCreated, db.GameEventData{Player1: &p1Data, Player2: &p2Data})
 
 	go game.Start()
 
-	GameManagerInstance.AddGame(game)
+	m.Manager.AddGame(game)
 }
 
 // GameManager to keep track of active games
@@ -100,11 +259,41 @@ type GameManager struct {
 	Games       map[string]*Game
 	PlayerGames map[string]string // PlayerID -> GameID
 	Mutex       sync.RWMutex
+
+	Clock  Clock
+	Store  db.Store
+	Stream analytics.EventStream
+	Lobby  *Lobby       // Told when players start and finish games; set by NewLobby
+	Tokens *auth.Signer // Signs the reconnect tokens handed out with GAME_START
 }
 
-var GameManagerInstance = &GameManager{
-	Games:       make(map[string]*Game),
-	PlayerGames: make(map[string]string),
+// NewGameManager creates a manager whose games use the given clock, store and
+// event stream. Nil dependencies fall back to real time, in-memory storage
+// and no analytics.
+func NewGameManager(clock Clock, store db.Store, stream analytics.EventStream) *GameManager {
+	if clock == nil {
+		clock = RealClock{}
+	}
+	if store == nil {
+		store = db.NewMemoryStore()
+	}
+	if stream == nil {
+		stream = analytics.NopStream{}
+	}
+
+	// Tokens signed with a random secret stop working on restart; servers
+	// replace this with a signer using the configured secret
+	secret := make([]byte, 32)
+	rand.Read(secret)
+
+	return &GameManager{
+		Games:       make(map[string]*Game),
+		PlayerGames: make(map[string]string),
+		Clock:       clock,
+		Store:       store,
+		Stream:      stream,
+		Tokens:      auth.NewSigner(secret, ReconnectTokenTTL),
+	}
 }
 
 func (gm *GameManager) AddGame(g *Game) {
@@ -179,3 +368,35 @@ func (gm *GameManager) GetPlayerByUsername(username string) (*Player, *Game) {
 	}
 	return nil, nil
 }
+
+// Blocked reports whether either account has blocked the other. Guests and
+// bots have no account, so they cannot block or be blocked. A failed lookup
+// is logged and treated as no block so matchmaking keeps working without the
+// database.
+func (gm *GameManager) Blocked(userID, otherID string) bool {
+	if userID == "" || otherID == "" {
+		return false
+	}
+	blocked, err := gm.Store.IsBlocked(userID, otherID)
+	if err != nil {
+		log.Printf("Failed to check blocks between %s and %s: %v", userID, otherID, err)
+		return false
+	}
+	return blocked
+}
+
+// IsUserPlaying reports whether the account userID has a seat in an active game
+func (gm *GameManager) IsUserPlaying(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	gm.Mutex.RLock()
+	defer gm.Mutex.RUnlock()
+
+	for _, g := range gm.Games {
+		if g.State == "active" && (g.Player1.UserID == userID || g.Player2.UserID == userID) {
+			return true
+		}
+	}
+	return false
+}
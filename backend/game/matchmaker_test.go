@@ -0,0 +1,163 @@
+package game
+
+import (
+	"testing"
+	"time"
+
+	"4-in-a-row/db"
+)
+
+func TestMatchTimeoutStartsBotGame(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	gm := NewGameManager(clock, nil, nil)
+	m := NewMatchmaker(gm)
+	p := &Player{ID: "p1", Username: "alice", IsConnected: true}
+
+	m.AddPlayer(p)
+	clock.Advance(MatchTimeout - time.Millisecond)
+	if g := gm.GetGameByPlayerID(p.ID); g != nil {
+		t.Fatal("bot game started before MatchTimeout")
+	}
+
+	clock.Advance(time.Millisecond)
+	g := gm.GetGameByPlayerID(p.ID)
+	if g == nil {
+		t.Fatal("no bot game after MatchTimeout")
+	}
+	if !g.Player2.IsBot {
+		t.Errorf("opponent %s is not a bot", g.Player2.Username)
+	}
+	if _, waiting := m.QueueStatus(p); waiting {
+		t.Error("player is still queued")
+	}
+}
+
+func TestQueueStatusCountsDown(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	m := NewMatchmaker(NewGameManager(clock, nil, nil))
+	p := &Player{ID: "p1", Username: "alice", IsConnected: true}
+
+	m.AddPlayer(p)
+	clock.Advance(4 * time.Second)
+
+	status, ok := m.QueueStatus(p)
+	if !ok {
+		t.Fatal("player is not queued")
+	}
+	want := int((MatchTimeout - 4*time.Second).Seconds())
+	if status.ElapsedSeconds != 4 || status.BotFallbackIn != want {
+		t.Errorf("got elapsed %ds, bot in %ds; want 4s and %ds", status.ElapsedSeconds, status.BotFallbackIn, want)
+	}
+}
+
+func TestPairedPlayersGetNoBot(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	gm := NewGameManager(clock, nil, nil)
+	m := NewMatchmaker(gm)
+	p1 := &Player{ID: "p1", Username: "alice", IsConnected: true}
+	p2 := &Player{ID: "p2", Username: "bob", IsConnected: true}
+
+	m.AddPlayer(p1)
+	clock.Advance(MatchTimeout / 2)
+	m.AddPlayer(p2)
+
+	g := gm.GetGameByPlayerID(p1.ID)
+	if g == nil || g != gm.GetGameByPlayerID(p2.ID) {
+		t.Fatal("queued players were not paired")
+	}
+
+	clock.Advance(MatchTimeout)
+	if g := gm.GetGameByPlayerID(p1.ID); g == nil || g.Player2.IsBot {
+		t.Error("fallback timer replaced the paired game with a bot game")
+	}
+}
+
+func TestBlockedPlayersAreNotPaired(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	store := db.NewMemoryStore()
+	gm := NewGameManager(clock, store, nil)
+	m := NewMatchmaker(gm)
+	p1 := &Player{ID: "p1", UserID: "u1", Username: "alice", IsConnected: true}
+	p2 := &Player{ID: "p2", UserID: "u2", Username: "bob", IsConnected: true}
+	p3 := &Player{ID: "p3", UserID: "u3", Username: "carol", IsConnected: true}
+	if err := store.CreateBlock(&db.Block{BlockerID: "u1", BlockedID: "u2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m.AddPlayer(p1)
+	m.AddPlayer(p2)
+	if g := gm.GetGameByPlayerID(p2.ID); g != nil {
+		t.Fatal("players who blocked each other were paired")
+	}
+
+	m.AddPlayer(p3)
+	g := gm.GetGameByPlayerID(p3.ID)
+	if g == nil || g.Player1 != p1 {
+		t.Fatal("newcomer was not paired with the longest-waiting player")
+	}
+	if _, waiting := m.QueueStatus(p2); !waiting {
+		t.Error("blocked player left the queue")
+	}
+}
+
+func TestMatchTimeoutUpdatesQueue(t *testing.T) {
+	clock := NewFakeClock(testStart)
+	store := db.NewMemoryStore()
+	gm := NewGameManager(clock, store, nil)
+	m := NewMatchmaker(gm)
+	p1 := &Player{ID: "p1", UserID: "u1", Username: "alice", IsConnected: true}
+	p2 := &Player{ID: "p2", UserID: "u2", Username: "bob", IsConnected: true}
+	if err := store.CreateBlock(&db.Block{BlockerID: "u1", BlockedID: "u2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m.AddPlayer(p1)
+	clock.Advance(time.Second)
+	m.AddPlayer(p2)
+	clock.Advance(MatchTimeout - time.Second)
+	if gm.GetGameByPlayerID(p1.ID) == nil {
+		t.Fatal("no bot game after MatchTimeout")
+	}
+
+	last := p2.replay[len(p2.replay)-1]
+	status, ok := last.Payload.(QueueStatusPayload)
+	if last.Type != MsgQueueStatus || !ok {
+		t.Fatalf("last message to the player left waiting is %s", last.Type)
+	}
+	if status.Position != 1 || status.PlayersWaiting != 1 {
+		t.Errorf("got position %d of %d, want 1 of 1", status.Position, status.PlayersWaiting)
+	}
+}
+
+func TestManagersShareNoState(t *testing.T) {
+	clock1, clock2 := NewFakeClock(testStart), NewFakeClock(testStart)
+	gm1, gm2 := NewGameManager(clock1, nil, nil), NewGameManager(clock2, nil, nil)
+	m1, m2 := NewMatchmaker(gm1), NewMatchmaker(gm2)
+	p1 := &Player{ID: "p1", Username: "alice", IsConnected: true}
+	p2 := &Player{ID: "p2", Username: "bob", IsConnected: true}
+
+	m1.AddPlayer(p1)
+	m2.AddPlayer(p2)
+	if gm1.GetGameByPlayerID(p1.ID) != nil || gm2.GetGameByPlayerID(p2.ID) != nil {
+		t.Fatal("players in different matchmakers were paired")
+	}
+
+	clock2.Advance(MatchTimeout)
+	if gm1.GetGameByPlayerID(p1.ID) != nil {
+		t.Fatal("advancing the second clock fired the first matchmaker's timer")
+	}
+	if gm2.GetGameByPlayerID(p2.ID) == nil {
+		t.Fatal("second matchmaker did not start its bot game")
+	}
+	if _, waiting := m1.QueueStatus(p1); !waiting {
+		t.Error("first queue lost its player")
+	}
+
+	token, err := gm1.Tokens.IssueReconnect("game-1", p1.ID, testStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gm2.Tokens.VerifyReconnect(token, testStart); err == nil {
+		t.Error("second manager accepted a reconnect token signed by the first")
+	}
+}
@@ -10,11 +10,47 @@ const (
 	MsgError        = "ERROR"
 	MsgReconnect    = "RECONNECT"
 	MsgPlayerStatus = "PLAYER_STATUS"
+	MsgResumed      = "RESUMED"
+	MsgHello        = "HELLO"
+	MsgWelcome      = "WELCOME"
+	MsgAck          = "ACK"
+	MsgNack         = "NACK"
+	MsgLeaveQueue   = "LEAVE_QUEUE"
+	MsgQueueStatus  = "QUEUE_STATUS"
+	MsgDelta        = "GAME_DELTA"
+	MsgSync         = "SYNC"
+
+	// Lobby
+	MsgLobbySubscribe   = "LOBBY_SUBSCRIBE"
+	MsgLobbyUnsubscribe = "LOBBY_UNSUBSCRIBE"
+	MsgLobbyState       = "LOBBY_STATE"
+	MsgLobbyPresence    = "LOBBY_PRESENCE"
+	MsgChallengePost    = "CHALLENGE_POST"
+	MsgChallengeCancel  = "CHALLENGE_CANCEL"
+	MsgChallengeAccept  = "CHALLENGE_ACCEPT"
+	MsgChallengePosted  = "CHALLENGE_POSTED"
+	MsgChallengeRemoved = "CHALLENGE_REMOVED"
+
+	// Direct challenges between friends
+	MsgChallenge         = "CHALLENGE"
+	MsgChallengeDecline  = "CHALLENGE_DECLINE"
+	MsgChallengeReceived = "CHALLENGE_RECEIVED"
+	MsgChallengeSent     = "CHALLENGE_SENT"
+
+	// Operators
+	MsgServerNotice = "SERVER_NOTICE"
 )
 
 type Message struct {
 	Type    string      `json:"type"`
 	Payload interface{} `json:"payload"`
+	Seq     int64       `json:"seq,omitempty"` // Per-session sequence number, set on server messages
+}
+
+// ReconnectRequest is the RECONNECT payload; the token may also be sent as a bare string
+type ReconnectRequest struct {
+	Token   string `json:"token"`             // Reconnect token from GAME_START, RECONNECT or RESUMED
+	LastSeq int64  `json:"lastSeq,omitempty"` // Last sequence number the client processed
 }
 
 type PlayerInfo struct {
@@ -26,10 +62,11 @@ type PlayerInfo struct {
 }
 
 type GameStartPayload struct {
-	GameID   string     `json:"gameId"`
-	You      PlayerInfo `json:"you"`
-	Opponent PlayerInfo `json:"opponent"`
-	YourTurn bool       `json:"yourTurn"`
+	GameID         string     `json:"gameId"`
+	You            PlayerInfo `json:"you"`
+	Opponent       PlayerInfo `json:"opponent"`
+	YourTurn       bool       `json:"yourTurn"`
+	ReconnectToken string     `json:"reconnectToken"` // Send in RECONNECT to reclaim this seat
 }
 
 type LastMove struct {
@@ -53,14 +90,49 @@ type ReconnectPayload struct {
 	CurrentTurn int             `json:"currentTurn"`
 	YourTurn    bool            `json:"yourTurn"`
 	MoveNumber  int             `json:"moveNumber"`
+
+	ReconnectToken string `json:"reconnectToken"` // Renewed token for the next reconnect
+}
+
+// ResumedPayload confirms a resumed session after the missed messages were replayed
+type ResumedPayload struct {
+	GameID   string `json:"gameId"`
+	LastSeq  int64  `json:"lastSeq"`  // Sequence number the client resumed from
+	Replayed int    `json:"replayed"` // Number of messages replayed
+
+	ReconnectToken string `json:"reconnectToken"` // Renewed token for the next reconnect
+}
+
+// QueueStatusPayload tells a waiting player where they stand in matchmaking
+type QueueStatusPayload struct {
+	InQueue        bool `json:"inQueue"`
+	Position       int  `json:"position,omitempty"` // 1-based
+	PlayersWaiting int  `json:"playersWaiting"`
+	ElapsedSeconds int  `json:"elapsedSeconds"`
+	BotFallbackIn  int  `json:"botFallbackIn"` // Seconds until a bot game starts
 }
 
 type GameOverPayload struct {
-	Winner string `json:"winner"` // "1", "2", or "draw"
+	Winner string `json:"winner"`           // Winner's username, "draw", or empty when aborted without a result
+	Reason string `json:"reason,omitempty"` // Set when the game did not end on the board, e.g. "aborted"
+}
+
+// Levels of a SERVER_NOTICE
+const (
+	NoticeInfo    = "info"
+	NoticeWarning = "warning"
+)
+
+// ServerNoticePayload is an operator's announcement to every connected client
+type ServerNoticePayload struct {
+	Message string `json:"message"`
+	Level   string `json:"level"` // "info" or "warning"
 }
 
 type PlayerStatusPayload struct {
-	PlayerSymbol int  `json:"playerSymbol"`
-	IsOnline     bool `json:"isOnline"`
-	TimeLeft     int  `json:"timeLeft"` // Seconds left before forfeit (0 if online)
+	PlayerSymbol int    `json:"playerSymbol"`
+	IsOnline     bool   `json:"isOnline"`
+	TimeLeft     int    `json:"timeLeft"`            // Seconds left before forfeit (0 if online)
+	LatencyMs    int    `json:"latencyMs,omitempty"` // Round-trip time of the player's connection
+	Quality      string `json:"quality,omitempty"`   // "good", "fair" or "poor"
 }
@@ -1,23 +1,178 @@
 package game
 
 import (
-	"github.com/gorilla/websocket"
+	"sync"
 	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReplayBufferSize is how many recent messages a session keeps for resuming
+const ReplayBufferSize = 128
+
+// ReplyCacheSize is how many request replies a session remembers so resent
+// requests are answered without being applied twice
+const ReplyCacheSize = 64
+
+// Connection quality levels reported to the opponent
+const (
+	QualityGood = "good"
+	QualityFair = "fair"
+	QualityPoor = "poor"
 )
 
 type Player struct {
 	ID             string
+	UserID         string // Account the player is logged in as; empty for guests and bots
 	Username       string
 	Conn           *websocket.Conn
 	IsBot          bool
 	Symbol         int // 1 or 2
 	IsConnected    bool
 	DisconnectedAt time.Time
+	Latency        time.Duration // Smoothed heartbeat round-trip time
+
+	sendMu sync.Mutex // Serialises writes and guards the session state below
+	client ClientInfo // Protocol agreed on the current connection
+	seq    int64      // Sequence number of the last message sent in this session
+	replay []Message  // Most recent messages, oldest first, for resuming
+
+	replies ReplyCache
+}
+
+// ConnectionQuality buckets a round-trip time into a quality level
+func ConnectionQuality(rtt time.Duration) string {
+	switch {
+	case rtt < 150*time.Millisecond:
+		return QualityGood
+	case rtt < 400*time.Millisecond:
+		return QualityFair
+	default:
+		return QualityPoor
+	}
 }
 
-func (p *Player) SendMessage(msg interface{}) error {
-	if p.IsBot || p.Conn == nil {
+// SendMessage stamps msg with the next session sequence number, keeps it for
+// replay and writes it if the player has a connection attached
+func (p *Player) SendMessage(msg Message) error {
+	if p.IsBot {
 		return nil
 	}
-	return p.Conn.WriteJSON(msg)
+
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+
+	p.seq++
+	msg.Seq = p.seq
+	p.replay = append(p.replay, msg)
+	if len(p.replay) > ReplayBufferSize {
+		p.replay = p.replay[len(p.replay)-ReplayBufferSize:]
+	}
+
+	if p.Conn == nil {
+		return nil
+	}
+	return p.client.WriteMessage(p.Conn, msg)
+}
+
+// Attach sets the connection that session messages are written to and the
+// protocol agreed on it
+func (p *Player) Attach(conn *websocket.Conn, client ClientInfo) {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	p.Conn = conn
+	p.client = client
+}
+
+// Client returns the protocol agreed on the player's current connection
+func (p *Player) Client() ClientInfo {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	return p.client
+}
+
+// AttachedTo reports whether conn is the player's current connection
+func (p *Player) AttachedTo(conn *websocket.Conn) bool {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	return p.Conn == conn
+}
+
+// Detach stops writing to the player's connection; messages are still
+// numbered and buffered so they can be replayed on resume
+func (p *Player) Detach() {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+	p.Conn = nil
+}
+
+// Resume attaches conn and replays every message after lastSeq. It returns
+// false without attaching if the gap is no longer in the replay buffer.
+func (p *Player) Resume(conn *websocket.Conn, client ClientInfo, lastSeq int64) (int, bool) {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+
+	if lastSeq <= 0 || lastSeq > p.seq {
+		return 0, false
+	}
+	oldest := p.seq + 1
+	if len(p.replay) > 0 {
+		oldest = p.replay[0].Seq
+	}
+	if lastSeq < oldest-1 {
+		return 0, false
+	}
+
+	p.Conn = conn
+	p.client = client
+	replayed := 0
+	for _, msg := range p.replay {
+		if msg.Seq <= lastSeq {
+			continue
+		}
+		if err := client.WriteMessage(conn, msg); err != nil {
+			return replayed, true
+		}
+		replayed++
+	}
+	return replayed, true
+}
+
+// Replies returns the session's cache of answered requests
+func (p *Player) Replies() *ReplyCache {
+	return &p.replies
+}
+
+// ReplyCache remembers the ACK/NACK sent for recent request IDs
+type ReplyCache struct {
+	mu      sync.Mutex
+	replies map[string]Message
+	order   []string
+}
+
+// Get returns the reply previously sent for id
+func (c *ReplyCache) Get(id string) (Message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reply, ok := c.replies[id]
+	return reply, ok
+}
+
+// Put remembers the reply for id, evicting the oldest entry when full
+func (c *ReplyCache) Put(id string, reply Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.replies == nil {
+		c.replies = make(map[string]Message)
+	}
+	if _, ok := c.replies[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.replies[id] = reply
+
+	if len(c.order) > ReplyCacheSize {
+		delete(c.replies, c.order[0])
+		c.order = c.order[1:]
+	}
 }
@@ -0,0 +1,53 @@
+package game
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReplyCacheReturnsStoredReply(t *testing.T) {
+	var c ReplyCache
+	if _, ok := c.Get("r1"); ok {
+		t.Fatal("empty cache returned a reply")
+	}
+
+	nack := ReplyMessage(&ClientMessage{ID: "r1", Type: MsgMove}, &ProtocolError{Code: ErrCodeNotYourTurn, Message: "Not your turn"})
+	c.Put("r1", nack)
+	got, ok := c.Get("r1")
+	if !ok || got.Type != MsgNack {
+		t.Fatalf("got %+v, %v; want the stored NACK", got, ok)
+	}
+}
+
+func TestReplyCacheEvictsOldest(t *testing.T) {
+	var c ReplyCache
+	for i := 0; i <= ReplyCacheSize; i++ {
+		c.Put(fmt.Sprint(i), Message{Type: MsgAck})
+	}
+
+	if _, ok := c.Get("0"); ok {
+		t.Error("oldest reply survived a full cache")
+	}
+	for _, id := range []string{"1", fmt.Sprint(ReplyCacheSize)} {
+		if _, ok := c.Get(id); !ok {
+			t.Errorf("reply %s was evicted too early", id)
+		}
+	}
+}
+
+func TestReplyCacheOverwriteKeepsPlace(t *testing.T) {
+	var c ReplyCache
+	c.Put("a", Message{Type: MsgAck})
+	for i := 0; i < ReplyCacheSize-1; i++ {
+		c.Put(fmt.Sprint(i), Message{Type: MsgAck})
+	}
+	c.Put("a", Message{Type: MsgNack}) // Same ID; must not take a second slot
+
+	c.Put("new", Message{Type: MsgAck})
+	if _, ok := c.Get("0"); !ok {
+		t.Error("overwriting an ID took an extra slot")
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("overwriting an ID moved it to the back of the queue")
+	}
+}
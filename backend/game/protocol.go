@@ -0,0 +1,123 @@
+package game
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Protocol versions
+const (
+	ProtocolVersion       = 2 // Newest version the server speaks
+	MinProtocolVersion    = 1 // Oldest version still accepted
+	LegacyProtocolVersion = 1 // Assumed for clients that never send HELLO
+)
+
+// Optional protocol features a client can ask for in HELLO
+const (
+	FeatureVariants = "variants"
+	FeatureClocks   = "clocks"
+	FeatureChat     = "chat"
+	FeatureBinary   = "binary"
+	FeatureDeltas   = "deltas" // GAME_DELTA instead of full-grid GAME_UPDATE
+)
+
+// SupportedFeatures lists the features this server can enable
+var SupportedFeatures = []string{FeatureBinary, FeatureDeltas}
+
+// ClientInfo is what was agreed with a client during the upgrade and handshake
+type ClientInfo struct {
+	Version  int
+	Features map[string]bool
+	Codec    Codec // Wire encoding chosen by WebSocket subprotocol
+}
+
+// LegacyClient describes a client that has not sent HELLO (yet)
+func LegacyClient(codec Codec) ClientInfo {
+	return ClientInfo{Version: LegacyProtocolVersion, Features: map[string]bool{}, Codec: codec}
+}
+
+// Has reports whether a feature was agreed
+func (c ClientInfo) Has(feature string) bool {
+	return c.Features[feature]
+}
+
+type HelloPayload struct {
+	Version  int      `json:"version"`
+	Features []string `json:"features"`
+}
+
+type WelcomePayload struct {
+	Version       int      `json:"version"`       // Version used for this connection
+	ServerVersion int      `json:"serverVersion"` // Newest version the server speaks
+	MinVersion    int      `json:"minVersion"`
+	Features      []string `json:"features"` // Features enabled for this connection
+	Deprecated    bool     `json:"deprecated,omitempty"`
+	Sunset        string   `json:"sunset,omitempty"` // When the agreed version stops being accepted
+}
+
+// Negotiate agrees on a protocol version and feature set for a HELLO on a
+// connection using codec. The binary feature follows the codec, not the
+// HELLO. Legacy versions are only accepted until legacySunset (zero means no
+// sunset yet).
+func Negotiate(hello HelloPayload, codec Codec, now, legacySunset time.Time) (ClientInfo, WelcomePayload, error) {
+	if hello.Version < MinProtocolVersion {
+		return ClientInfo{}, WelcomePayload{}, fmt.Errorf(
+			"protocol version %d is no longer supported; minimum is %d", hello.Version, MinProtocolVersion)
+	}
+
+	version := hello.Version
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+
+	if version == LegacyProtocolVersion && !LegacyAllowed(now, legacySunset) {
+		return ClientInfo{}, WelcomePayload{}, fmt.Errorf(
+			"protocol version %d was retired on %s; please upgrade to version %d",
+			version, legacySunset.Format("2006-01-02"), ProtocolVersion)
+	}
+
+	client := ClientInfo{Version: version, Features: map[string]bool{}, Codec: codec}
+	agreed := make([]string, 0)
+	for _, f := range hello.Features {
+		if !client.Features[f] && f != FeatureBinary && isSupportedFeature(f) {
+			client.Features[f] = true
+			agreed = append(agreed, f)
+		}
+	}
+	if codec.FrameType() == websocket.BinaryMessage {
+		client.Features[FeatureBinary] = true
+		agreed = append(agreed, FeatureBinary)
+	}
+
+	welcome := WelcomePayload{
+		Version:       version,
+		ServerVersion: ProtocolVersion,
+		MinVersion:    MinProtocolVersion,
+		Features:      agreed,
+	}
+	if version == LegacyProtocolVersion {
+		welcome.Deprecated = true
+		if !legacySunset.IsZero() {
+			welcome.Sunset = legacySunset.Format(time.RFC3339)
+		}
+	}
+
+	return client, welcome, nil
+}
+
+// LegacyAllowed reports whether the legacy protocol is still inside its
+// deprecation window
+func LegacyAllowed(now, legacySunset time.Time) bool {
+	return legacySunset.IsZero() || now.Before(legacySunset)
+}
+
+func isSupportedFeature(feature string) bool {
+	for _, f := range SupportedFeatures {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
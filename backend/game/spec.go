@@ -0,0 +1,61 @@
+package game
+
+//go:generate go run ../cmd/protocolgen -src . -spec ../protocol/asyncapi.json -ts ../../frontend/lib/protocol.ts
+
+// Directions a message can travel in
+const (
+	FromClient = "client"
+	FromServer = "server"
+)
+
+// MessageSpec describes one WebSocket message for the generated protocol
+// spec. Payload is a zero value of the payload type, or nil for messages
+// without one.
+type MessageSpec struct {
+	Type      string
+	Direction string
+	Summary   string
+	Payload   interface{}
+	Legacy    bool // Legacy clients send or receive the payload as a bare string
+}
+
+// Messages lists every message of the WebSocket protocol. Keep it in step
+// with the handler switch; `make protocol` regenerates the spec from it.
+var Messages = []MessageSpec{
+	// Client to server
+	{Type: MsgHello, Direction: FromClient, Summary: "Negotiate the protocol version and features", Payload: HelloPayload{}},
+	{Type: MsgJoinQueue, Direction: FromClient, Summary: "Join matchmaking", Payload: JoinQueuePayload{}, Legacy: true},
+	{Type: MsgLeaveQueue, Direction: FromClient, Summary: "Leave matchmaking"},
+	{Type: MsgReconnect, Direction: FromClient, Summary: "Resume a game after a dropped connection", Payload: ReconnectRequest{}, Legacy: true},
+	{Type: MsgMove, Direction: FromClient, Summary: "Drop a disc", Payload: MovePayload{}},
+	{Type: MsgSync, Direction: FromClient, Summary: "Ask for a full snapshot of a game", Payload: SyncRequest{}},
+	{Type: MsgLobbySubscribe, Direction: FromClient, Summary: "Join the lobby", Payload: LobbySubscribePayload{}},
+	{Type: MsgLobbyUnsubscribe, Direction: FromClient, Summary: "Leave the lobby"},
+	{Type: MsgChallengePost, Direction: FromClient, Summary: "Post an open challenge", Payload: ChallengeRequest{}},
+	{Type: MsgChallengeCancel, Direction: FromClient, Summary: "Withdraw your open challenge", Payload: ChallengeRef{}},
+	{Type: MsgChallengeAccept, Direction: FromClient, Summary: "Accept an open challenge, or a direct challenge sent to you", Payload: ChallengeRef{}},
+	{Type: MsgChallenge, Direction: FromClient, Summary: "Challenge a friend who is in the lobby", Payload: DirectChallengeRequest{}},
+	{Type: MsgChallengeDecline, Direction: FromClient, Summary: "Turn down a direct challenge", Payload: ChallengeRef{}},
+
+	// Server to client
+	{Type: MsgWelcome, Direction: FromServer, Summary: "Reply to HELLO", Payload: WelcomePayload{}},
+	{Type: MsgAck, Direction: FromServer, Summary: "A request with an ID succeeded", Payload: AckPayload{}},
+	{Type: MsgNack, Direction: FromServer, Summary: "A request with an ID failed", Payload: NackPayload{}},
+	{Type: MsgError, Direction: FromServer, Summary: "A request without an ID failed", Payload: ErrorPayload{}, Legacy: true},
+	{Type: MsgQueueStatus, Direction: FromServer, Summary: "Matchmaking progress", Payload: QueueStatusPayload{}},
+	{Type: MsgGameStart, Direction: FromServer, Summary: "A game was found", Payload: GameStartPayload{}},
+	{Type: MsgUpdate, Direction: FromServer, Summary: "Full position after a move", Payload: GameUpdatePayload{}},
+	{Type: MsgDelta, Direction: FromServer, Summary: "A move, for clients that agreed on the deltas feature", Payload: DeltaPayload{}},
+	{Type: MsgSync, Direction: FromServer, Summary: "Full snapshot of a game", Payload: SyncPayload{}},
+	{Type: MsgGameOver, Direction: FromServer, Summary: "The game ended", Payload: GameOverPayload{}},
+	{Type: MsgReconnect, Direction: FromServer, Summary: "Snapshot after reconnecting", Payload: ReconnectPayload{}},
+	{Type: MsgResumed, Direction: FromServer, Summary: "Missed messages were replayed", Payload: ResumedPayload{}},
+	{Type: MsgPlayerStatus, Direction: FromServer, Summary: "The opponent's connection changed", Payload: PlayerStatusPayload{}},
+	{Type: MsgLobbyState, Direction: FromServer, Summary: "Lobby members and challenges", Payload: LobbyStatePayload{}},
+	{Type: MsgLobbyPresence, Direction: FromServer, Summary: "A lobby member joined, left or changed status", Payload: LobbyPresencePayload{}},
+	{Type: MsgChallengePosted, Direction: FromServer, Summary: "A challenge was posted", Payload: ChallengeInfo{}},
+	{Type: MsgChallengeRemoved, Direction: FromServer, Summary: "A challenge was taken off the board, or a direct challenge ended", Payload: ChallengeRemovedPayload{}},
+	{Type: MsgChallengeReceived, Direction: FromServer, Summary: "A friend challenged you", Payload: ChallengeInfo{}},
+	{Type: MsgChallengeSent, Direction: FromServer, Summary: "Your direct challenge was delivered", Payload: ChallengeInfo{}},
+	{Type: MsgServerNotice, Direction: FromServer, Summary: "An operator announcement", Payload: ServerNoticePayload{}},
+}
@@ -0,0 +1,76 @@
+package game
+
+import (
+	"sync"
+
+	"4-in-a-row/db"
+)
+
+// watcherBuffer is how many events a watcher may fall behind before it is
+// dropped; it can resume from the last event it saw
+const watcherBuffer = 64
+
+// watcher receives a live game's events as they are recorded
+type watcher struct {
+	ch        chan db.GameEvent
+	closeOnce sync.Once
+}
+
+func (w *watcher) close() {
+	w.closeOnce.Do(func() { close(w.ch) })
+}
+
+// Watch returns the events recorded after lastSeq and a channel receiving
+// the ones recorded from now on. The channel is nil if the game is already
+// finished, and is closed once it finishes or if the reader falls too far
+// behind; stop must be called when the caller is done watching.
+func (g *Game) Watch(lastSeq int) (backlog []db.GameEvent, events <-chan db.GameEvent, stop func()) {
+	g.Mutex.Lock()
+	defer g.Mutex.Unlock()
+
+	if lastSeq < 0 {
+		lastSeq = 0
+	}
+	if lastSeq < len(g.Events) {
+		backlog = append(backlog, g.Events[lastSeq:]...)
+	}
+
+	if g.State == "finished" {
+		return backlog, nil, func() {}
+	}
+
+	w := &watcher{ch: make(chan db.GameEvent, watcherBuffer)}
+
+	if g.watchers == nil {
+		g.watchers = make(map[*watcher]struct{})
+	}
+	g.watchers[w] = struct{}{}
+
+	stop = func() {
+		g.Mutex.Lock()
+		defer g.Mutex.Unlock()
+		delete(g.watchers, w)
+		w.close()
+	}
+	return backlog, w.ch, stop
+}
+
+// notifyWatchers hands a newly recorded event to every watcher. Callers must
+// hold g.Mutex.
+func (g *Game) notifyWatchers(event db.GameEvent) {
+	for w := range g.watchers {
+		select {
+		case w.ch <- event:
+		default: // Too slow; it has to resume from its last event
+			delete(g.watchers, w)
+			w.close()
+		}
+	}
+
+	if event.Type == EventFinished {
+		for w := range g.watchers {
+			delete(g.watchers, w)
+			w.close()
+		}
+	}
+}
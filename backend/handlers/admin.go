@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+	"4-in-a-row/names"
+)
+
+// ResolveReportRequest is the body of POST /admin/reports/{id}/resolve
+type ResolveReportRequest struct {
+	Status     string `json:"status"` // resolved or dismissed
+	Resolution string `json:"resolution"`
+}
+
+// AbortGameRequest is the body of POST /admin/games/{id}/abort
+type AbortGameRequest struct {
+	Winner string `json:"winner"` // none, player1, player2 or draw
+}
+
+// NoticeRequest is the body of POST /admin/notices
+type NoticeRequest struct {
+	Message string `json:"message"`
+	Level   string `json:"level"` // info (default) or warning
+}
+
+// NoticeResponse says how many connections a notice was sent to
+type NoticeResponse struct {
+	Delivered int `json:"delivered"`
+}
+
+// BanRequest is the body of POST /admin/bans. Exactly one of Username and
+// IP is set; a username that belongs to an account bans the account.
+type BanRequest struct {
+	Username string `json:"username,omitempty"`
+	IP       string `json:"ip,omitempty"` // Address or CIDR range
+	Reason   string `json:"reason"`
+	Duration string `json:"duration,omitempty"` // Such as "72h"; empty for a permanent ban
+}
+
+// BanResponse is a ban as shown to moderators
+type BanResponse struct {
+	ID        uint   `json:"id"`
+	Kind      string `json:"kind"` // account, username or ip
+	Target    string `json:"target"`
+	Reason    string `json:"reason"`
+	CreatedBy string `json:"createdBy"`
+	CreatedAt string `json:"createdAt"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	Kicked    int    `json:"kicked,omitempty"` // Connections closed when the ban was made
+}
+
+// abortWinners maps AbortGameRequest.Winner to Game.Winner
+var abortWinners = map[string]int{"none": 0, "player1": 1, "player2": 2, "draw": 3}
+
+// maxNoticeLength bounds a server notice
+const maxNoticeLength = 500
+
+// AdminGamesHandler lists the games in progress or about to be cleaned up
+// (GET /admin/games)
+func (s *Server) AdminGamesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Games.ListGames())
+}
+
+// AdminGameHandler returns a game's full state: board, moves and event log
+// (GET /admin/games/{id})
+func (s *Server) AdminGameHandler(w http.ResponseWriter, r *http.Request) {
+	g := s.Games.GetGame(r.PathValue("id"))
+	if g == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.Snapshot(true))
+}
+
+// AdminAbortGameHandler ends a game, either without a result or with the
+// given winner (POST /admin/games/{id}/abort)
+func (s *Server) AdminAbortGameHandler(w http.ResponseWriter, r *http.Request) {
+	admin := callerFrom(r)
+
+	var req AbortGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Body must be {winner}", http.StatusBadRequest)
+		return
+	}
+	if req.Winner == "" {
+		req.Winner = "none"
+	}
+	winner, ok := abortWinners[req.Winner]
+	if !ok {
+		http.Error(w, "winner must be none, player1, player2 or draw", http.StatusBadRequest)
+		return
+	}
+
+	g := s.Games.GetGame(r.PathValue("id"))
+	if g == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if err := g.Abort(winner); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("Admin %s aborted game %s (winner: %s)", admin.Username, g.ID, req.Winner)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.Snapshot(false))
+}
+
+// AdminQueueHandler lists the players waiting for a match (GET /admin/queue)
+func (s *Server) AdminQueueHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Matchmaker.Entries())
+}
+
+// AdminConnectionsHandler lists the open WebSocket connections
+// (GET /admin/connections)
+func (s *Server) AdminConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	all := s.clients.All()
+	conns := make([]ConnectionInfo, 0, len(all))
+	for _, c := range all {
+		conns = append(conns, c.info())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conns)
+}
+
+// AdminKickHandler closes a WebSocket connection (DELETE /admin/connections/{id}).
+// A player in a game is treated as disconnected and may still reconnect.
+func (s *Server) AdminKickHandler(w http.ResponseWriter, r *http.Request) {
+	admin := callerFrom(r)
+
+	c, ok := s.clients.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	}
+	info := c.info()
+	c.kick("kicked")
+	log.Printf("%s %s kicked connection %s (%s, %s)", admin.Role, admin.Username, info.ID, info.IP, info.Username)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminNoticeHandler sends a SERVER_NOTICE to every open connection
+// (POST /admin/notices)
+func (s *Server) AdminNoticeHandler(w http.ResponseWriter, r *http.Request) {
+	admin := callerFrom(r)
+
+	var req NoticeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Message == "" {
+		http.Error(w, "Body must be {message, level}", http.StatusBadRequest)
+		return
+	}
+	if len(req.Message) > maxNoticeLength {
+		http.Error(w, "Message must be at most 500 characters", http.StatusBadRequest)
+		return
+	}
+	switch req.Level {
+	case "":
+		req.Level = game.NoticeInfo
+	case game.NoticeInfo, game.NoticeWarning:
+	default:
+		http.Error(w, "level must be info or warning", http.StatusBadRequest)
+		return
+	}
+
+	msg := game.Message{Type: game.MsgServerNotice, Payload: game.ServerNoticePayload{Message: req.Message, Level: req.Level}}
+	all := s.clients.All()
+	for _, c := range all {
+		c.notify(msg)
+	}
+	log.Printf("Admin %s sent a %s notice to %d connections: %s", admin.Username, req.Level, len(all), req.Message)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NoticeResponse{Delivered: len(all)})
+}
+
+// AdminBansHandler lists the bans in force (GET /admin/bans)
+func (s *Server) AdminBansHandler(w http.ResponseWriter, r *http.Request) {
+	bans, err := s.Store.ListBans(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]BanResponse, 0, len(bans))
+	for _, b := range bans {
+		results = append(results, banResponse(b))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// AdminBanHandler bans an account, username, address or range and closes
+// the connections it covers (POST /admin/bans)
+func (s *Server) AdminBanHandler(w http.ResponseWriter, r *http.Request) {
+	admin := callerFrom(r)
+
+	var req BanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Username == "") == (req.IP == "") {
+		http.Error(w, "Body must be {username or ip, reason, duration}", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	ban := db.Ban{Reason: req.Reason, CreatedBy: admin.UserID}
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			http.Error(w, "duration must be a positive duration such as 72h", http.StatusBadRequest)
+			return
+		}
+		expires := now.Add(d)
+		ban.ExpiresAt = &expires
+	}
+
+	if req.IP != "" {
+		target, err := banTarget(req.IP)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ban.Kind, ban.Value, ban.Label = db.BanIP, target, target
+	} else {
+		username := names.Clean(req.Username)
+		user, err := s.Store.GetUserByUsername(username)
+		switch {
+		case err == nil:
+			ban.Kind, ban.Value, ban.Label = db.BanAccount, user.ID, user.Username
+		case errors.Is(err, db.ErrNotFound):
+			ban.Kind, ban.Value, ban.Label = db.BanUsername, names.Skeleton(username), username
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := s.Store.CreateBan(&ban); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.bans.Load(now); err != nil {
+		log.Printf("Failed to reload bans: %v", err)
+	}
+
+	resp := banResponse(ban)
+	for _, c := range s.clients.All() {
+		info := c.info()
+		if _, banned := s.bans.Match(info.UserID, info.Username, info.IP, now); banned {
+			c.kick("banned")
+			resp.Kicked++
+		}
+	}
+	log.Printf("%s %s banned %s %s (ban %d, %d connections closed): %s",
+		admin.Role, admin.Username, ban.Kind, ban.Label, ban.ID, resp.Kicked, ban.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AdminUnbanHandler lifts a ban (DELETE /admin/bans/{id})
+func (s *Server) AdminUnbanHandler(w http.ResponseWriter, r *http.Request) {
+	admin := callerFrom(r)
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ban ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.Store.DeleteBan(uint(id))
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "Ban not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.bans.Load(time.Now()); err != nil {
+		log.Printf("Failed to reload bans: %v", err)
+	}
+	log.Printf("%s %s lifted ban %d", admin.Role, admin.Username, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func banResponse(b db.Ban) BanResponse {
+	resp := BanResponse{
+		ID:        b.ID,
+		Kind:      b.Kind,
+		Target:    b.Label,
+		Reason:    b.Reason,
+		CreatedBy: b.CreatedBy,
+		CreatedAt: b.CreatedAt.Format(time.RFC3339),
+	}
+	if b.ExpiresAt != nil {
+		resp.ExpiresAt = b.ExpiresAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// AdminReportsHandler lists the moderation queue (GET /admin/reports). It
+// shows open reports unless ?status= asks for resolved, dismissed or all.
+func (s *Server) AdminReportsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = db.ReportOpen
+	case "all":
+		status = ""
+	case db.ReportOpen, db.ReportResolved, db.ReportDismissed:
+	default:
+		http.Error(w, "status must be open, resolved, dismissed or all", http.StatusBadRequest)
+		return
+	}
+
+	reports, err := s.Store.ListReports(status, 100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The list leaves out the moves; fetch a single report to review them
+	results := make([]ReportResponse, 0, len(reports))
+	for i := range reports {
+		resp := reportResponse(&reports[i])
+		resp.Moves = nil
+		results = append(results, resp)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// AdminReportHandler returns one report with its moves (GET /admin/reports/{id})
+func (s *Server) AdminReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, ok := s.reportFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reportResponse(report))
+}
+
+// AdminResolveReportHandler closes a report (POST /admin/reports/{id}/resolve)
+func (s *Server) AdminResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	admin := callerFrom(r)
+
+	var req ResolveReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Body must be {status, resolution}", http.StatusBadRequest)
+		return
+	}
+	if req.Status != db.ReportResolved && req.Status != db.ReportDismissed {
+		http.Error(w, "status must be resolved or dismissed", http.StatusBadRequest)
+		return
+	}
+
+	report, ok := s.reportFromPath(w, r)
+	if !ok {
+		return
+	}
+	if report.Status != db.ReportOpen {
+		http.Error(w, "Report is already "+report.Status, http.StatusConflict)
+		return
+	}
+
+	if err := s.Store.ResolveReport(report.ID, req.Status, req.Resolution, admin.UserID, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("%s %s marked report %d %s", admin.Role, admin.Username, report.ID, req.Status)
+
+	report, err := s.Store.GetReport(report.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reportResponse(report))
+}
+
+func (s *Server) reportFromPath(w http.ResponseWriter, r *http.Request) (*db.Report, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	report, err := s.Store.GetReport(uint(id))
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Report not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return report, true
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"4-in-a-row/auth"
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+	"4-in-a-row/names"
+
+	"github.com/google/uuid"
+)
+
+type CredentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ErrorResponse reports a failure with one of the game.ErrCode codes
+type ErrorResponse struct {
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Permission string `json:"permission,omitempty"` // What the caller lacked, with PERMISSION_DENIED and LOGIN_REQUIRED
+	Role       string `json:"role,omitempty"`       // The caller's role, with PERMISSION_DENIED
+}
+
+type UserResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// SessionResponse is returned by register and login; the token is sent as
+// "Authorization: Bearer <token>" or ?token=<token> when opening /ws
+type SessionResponse struct {
+	Token     string       `json:"token"`
+	ExpiresAt string       `json:"expiresAt"`
+	User      UserResponse `json:"user"`
+}
+
+// RegisterHandler creates an account and logs it in (POST /auth/register)
+func (s *Server) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	var req CredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Body must be {username, password}", http.StatusBadRequest)
+		return
+	}
+
+	username, err := s.checkUsername(req.Username)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, game.AsProtocolError(err))
+		return
+	}
+	if len(req.Password) < auth.MinPasswordLength {
+		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+	if len(req.Password) > auth.MaxPasswordLength {
+		http.Error(w, "Password must be at most 72 bytes", http.StatusBadRequest)
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user := &db.User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		PasswordHash: hash,
+	}
+	if err := s.Store.CreateUser(user); err != nil {
+		if errors.Is(err, db.ErrUsernameTaken) {
+			writeError(w, http.StatusConflict, &game.ProtocolError{
+				Code:    game.ErrCodeUsernameTaken,
+				Message: "That username, or one that looks like it, is already registered",
+			})
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Registered user %s (%s)", user.Username, user.ID)
+
+	s.writeSession(w, http.StatusCreated, user)
+}
+
+// LoginHandler exchanges a username and password for a session token (POST /auth/login)
+func (s *Server) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req CredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Body must be {username, password}", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.Store.GetUserByUsername(names.Clean(req.Username))
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hash := ""
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	if !auth.CheckPassword(hash, req.Password) {
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	s.writeSession(w, http.StatusOK, user)
+}
+
+func (s *Server) writeSession(w http.ResponseWriter, status int, user *db.User) {
+	token, expiresAt, err := s.Sessions.Issue(user.ID, user.Username, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(SessionResponse{
+		Token:     token,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+		User:      UserResponse{ID: user.ID, Username: user.Username, Role: string(auth.AccountRole(user.Role))},
+	})
+}
+
+// checkUsername applies the username policy, returning the name in its
+// normalized form or a ProtocolError with the violation's code
+func (s *Server) checkUsername(requested string) (string, error) {
+	username, err := s.Names.Normalize(requested)
+	if err == nil {
+		return username, nil
+	}
+
+	code := game.ErrCodeBadMessage
+	switch {
+	case errors.Is(err, names.ErrLength):
+		code = game.ErrCodeUsernameLength
+	case errors.Is(err, names.ErrCharacters):
+		code = game.ErrCodeUsernameCharacters
+	case errors.Is(err, names.ErrReserved):
+		code = game.ErrCodeUsernameReserved
+	case errors.Is(err, names.ErrBlocked):
+		code = game.ErrCodeUsernameBlocked
+	}
+	return "", &game.ProtocolError{Code: code, Message: "Invalid username: " + err.Error()}
+}
+
+func writeError(w http.ResponseWriter, status int, perr *game.ProtocolError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Code: perr.Code, Message: perr.Message})
+}
+
+// queryTokenRoutes are the routes that take the session token as ?token=,
+// since browsers cannot set headers on WebSocket and EventSource requests.
+// Everywhere else it must be sent as a header, so it does not end up in
+// logs and browser history.
+var queryTokenRoutes = map[string]bool{
+	"/ws":                    true,
+	"GET /games/{id}/events": true,
+}
+
+// sessionFromRequest verifies the session token of a request, if it has one
+func (s *Server) sessionFromRequest(r *http.Request) (*auth.Claims, error) {
+	var token string
+	if queryTokenRoutes[r.Pattern] {
+		token = r.URL.Query().Get("token")
+	}
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	if token == "" {
+		return nil, nil
+	}
+
+	claims, err := s.Sessions.Verify(token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
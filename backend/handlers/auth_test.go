@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"4-in-a-row/db"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRegisterPasswordLength(t *testing.T) {
+	_, ts := newTestServer(t, testConfig(), nil)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     int
+	}{
+		{"too short", "alice", "short", http.StatusBadRequest},
+		{"longest bcrypt takes", "bob", strings.Repeat("a", 72), http.StatusCreated},
+		{"too long", "carol", strings.Repeat("a", 73), http.StatusBadRequest},
+		{"too long in bytes", "dave", strings.Repeat("é", 37), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(CredentialsRequest{Username: tt.username, Password: tt.password})
+			resp, err := http.Post(ts.URL+"/auth/register", "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("got %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryTokenOnlyForStreams(t *testing.T) {
+	s, ts := newTestServer(t, testConfig(), nil)
+	if err := s.Store.CreateUser(&db.User{ID: "u1", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.Sessions.Issue("u1", "alice", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(ts.URL + "/friends?token=" + token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("/friends?token= got %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL+"/friends", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("/friends with the header got %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// An invalid ?token= is refused on /ws, so it was read there
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?token="
+	if _, resp, err := websocket.DefaultDialer.Dial(url+"garbage", nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("/ws with a bad ?token= was not refused: %v", err)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url+token, nil)
+	if err != nil {
+		t.Fatalf("/ws?token= refused: %v", err)
+	}
+	conn.Close()
+}
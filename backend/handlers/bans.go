@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+	"4-in-a-row/names"
+)
+
+// BanCounts counts attempts turned away by bans since the server started
+type BanCounts struct {
+	ActiveBans         int   `json:"activeBans"`
+	BlockedConnections int64 `json:"blockedConnections"` // Refused before the WebSocket upgrade
+	BlockedJoins       int64 `json:"blockedJoins"`       // Queue, lobby, challenge and reconnect messages refused
+}
+
+// bannedRange is an IP ban parsed for matching
+type bannedRange struct {
+	prefix netip.Prefix
+	ban    db.Ban
+}
+
+// banList caches the active bans so every connection and join can be
+// checked without a database query. It is reloaded every refresh interval
+// and straight after a ban is made or lifted here.
+type banList struct {
+	store db.Store
+
+	mu        sync.RWMutex
+	accounts  map[string]db.Ban // By user ID; the longest of overlapping bans
+	usernames map[string]db.Ban // By name skeleton; the longest of overlapping bans
+	ranges    []bannedRange
+	active    int // Bans loaded, counting overlapping ones
+
+	blockedConns atomic.Int64
+	blockedJoins atomic.Int64
+}
+
+func newBanList(store db.Store) *banList {
+	return &banList{
+		store:     store,
+		accounts:  make(map[string]db.Ban),
+		usernames: make(map[string]db.Ban),
+	}
+}
+
+// Load replaces the cache with the bans in force at now, dropping those that
+// have expired since the last load
+func (b *banList) Load(now time.Time) error {
+	bans, err := b.store.ListBans(now)
+	if err != nil {
+		return err
+	}
+
+	accounts := make(map[string]db.Ban)
+	usernames := make(map[string]db.Ban)
+	var ranges []bannedRange
+	for _, ban := range bans {
+		switch ban.Kind {
+		case db.BanAccount:
+			keepLongest(accounts, ban)
+		case db.BanUsername:
+			keepLongest(usernames, ban)
+		case db.BanIP:
+			prefix, err := netip.ParsePrefix(ban.Value)
+			if err != nil {
+				log.Printf("Skipping ban %d: invalid range %q", ban.ID, ban.Value)
+				continue
+			}
+			ranges = append(ranges, bannedRange{prefix: prefix, ban: ban})
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.accounts, b.usernames, b.ranges = accounts, usernames, ranges
+	b.active = len(bans)
+	return nil
+}
+
+// keepLongest stores ban under its value unless a ban that lasts at least as
+// long is already there, so a short ban made on top of a permanent one does
+// not lift the permanent one when it expires
+func keepLongest(bans map[string]db.Ban, ban db.Ban) {
+	if current, ok := bans[ban.Value]; !ok || lastsLonger(ban, current) {
+		bans[ban.Value] = ban
+	}
+}
+
+// lastsLonger reports whether ban a ends after ban b
+func lastsLonger(a, b db.Ban) bool {
+	if a.ExpiresAt == nil || b.ExpiresAt == nil {
+		return a.ExpiresAt == nil && b.ExpiresAt != nil
+	}
+	return a.ExpiresAt.After(*b.ExpiresAt)
+}
+
+// Refresh reloads the cache every interval until stop is closed. A failed
+// reload keeps the previous list.
+func (b *banList) Refresh(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := b.Load(time.Now()); err != nil {
+				log.Printf("Failed to reload bans: %v", err)
+			}
+		}
+	}
+}
+
+// Match returns the ban covering any of the given account, username or
+// address. Empty arguments are skipped.
+func (b *banList) Match(userID, username, ip string, now time.Time) (db.Ban, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if ban, ok := b.accounts[userID]; ok && userID != "" && ban.Active(now) {
+		return ban, true
+	}
+	if username != "" {
+		if ban, ok := b.usernames[names.Skeleton(username)]; ok && ban.Active(now) {
+			return ban, true
+		}
+	}
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		addr = addr.Unmap()
+		for _, r := range b.ranges {
+			if r.prefix.Contains(addr) && r.ban.Active(now) {
+				return r.ban, true
+			}
+		}
+	}
+	return db.Ban{}, false
+}
+
+// Counts returns the number of active bans and blocked attempts
+func (b *banList) Counts() BanCounts {
+	b.mu.RLock()
+	active := b.active
+	b.mu.RUnlock()
+
+	return BanCounts{
+		ActiveBans:         active,
+		BlockedConnections: b.blockedConns.Load(),
+		BlockedJoins:       b.blockedJoins.Load(),
+	}
+}
+
+// bannedError is the error shown to a banned client
+func bannedError(ban db.Ban) *game.ProtocolError {
+	msg := "You are banned"
+	if ban.ExpiresAt != nil {
+		msg += " until " + ban.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if ban.Reason != "" {
+		msg += ": " + ban.Reason
+	}
+	return &game.ProtocolError{Code: game.ErrCodeBanned, Message: msg}
+}
+
+// banTarget turns an address or CIDR range into the range an IP ban stores
+func banTarget(value string) (string, error) {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Masked().String(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return "", fmt.Errorf("%q is not an IP address or CIDR range", value)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()).String(), nil
+}
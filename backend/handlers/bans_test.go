@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"4-in-a-row/db"
+	"4-in-a-row/names"
+)
+
+var banStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// loadBans returns a ban list loaded at banStart with bans, created in order
+func loadBans(t *testing.T, bans ...db.Ban) *banList {
+	t.Helper()
+	store := db.NewMemoryStore()
+	for _, ban := range bans {
+		if err := store.CreateBan(&ban); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := newBanList(store)
+	if err := list.Load(banStart); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func banFor(d time.Duration) *time.Time {
+	expires := banStart.Add(d)
+	return &expires
+}
+
+func TestBanMatch(t *testing.T) {
+	list := loadBans(t,
+		db.Ban{Kind: db.BanAccount, Value: "u1", Label: "banned"},
+		db.Ban{Kind: db.BanAccount, Value: "u2", Label: "expired", ExpiresAt: banFor(-time.Minute)},
+		db.Ban{Kind: db.BanAccount, Value: "u3", Label: "hour", ExpiresAt: banFor(time.Hour)},
+		db.Ban{Kind: db.BanUsername, Value: names.Skeleton("mallory"), Label: "mallory"},
+		db.Ban{Kind: db.BanIP, Value: "203.0.113.0/24", Label: "range"},
+		db.Ban{Kind: db.BanIP, Value: "2001:db8::1/128", Label: "v6"},
+	)
+
+	tests := []struct {
+		name     string
+		userID   string
+		username string
+		ip       string
+		after    time.Duration // Since the list was loaded
+		want     string        // Label of the matching ban; empty for none
+	}{
+		{"nothing", "", "", "", 0, ""},
+		{"account", "u1", "", "", 0, "banned"},
+		{"other account", "u9", "alice", "198.51.100.1", 0, ""},
+		{"expired before load", "u2", "", "", 0, ""},
+		{"temporary", "u3", "", "", 59 * time.Minute, "hour"},
+		{"expired since load", "u3", "", "", time.Hour, ""},
+		{"username", "", "mallory", "", 0, "mallory"},
+		{"username case", "", "MALLORY", "", 0, "mallory"},
+		{"username lookalike", "", "ma1l0ry", "", 0, "mallory"},
+		{"username cyrillic", "", "маllоry", "", 0, "mallory"},
+		{"username containing", "", "mallory2", "", 0, ""},
+		{"address in range", "", "", "203.0.113.7", 0, "range"},
+		{"address outside range", "", "", "203.0.114.7", 0, ""},
+		{"mapped address", "", "", "::ffff:203.0.113.7", 0, "range"},
+		{"ipv6 address", "", "", "2001:db8::1", 0, "v6"},
+		{"ipv6 neighbour", "", "", "2001:db8::2", 0, ""},
+		{"invalid address", "", "", "not-an-ip", 0, ""},
+		{"any of them", "u9", "alice", "203.0.113.7", 0, "range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if ban, ok := list.Match(tt.userID, tt.username, tt.ip, banStart.Add(tt.after)); ok {
+				got = ban.Label
+			}
+			if got != tt.want {
+				t.Errorf("matched %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlappingBans(t *testing.T) {
+	tests := []struct {
+		name  string
+		first *time.Time
+		then  *time.Time
+		after time.Duration
+		want  bool
+	}{
+		{"permanent then temporary", nil, banFor(time.Hour), 2 * time.Hour, true},
+		{"temporary then permanent", banFor(time.Hour), nil, 2 * time.Hour, true},
+		{"short then long", banFor(time.Hour), banFor(3 * time.Hour), 2 * time.Hour, true},
+		{"long then short", banFor(3 * time.Hour), banFor(time.Hour), 2 * time.Hour, true},
+		{"both over", banFor(time.Hour), banFor(3 * time.Hour), 4 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skeleton := names.Skeleton("mallory")
+			list := loadBans(t,
+				db.Ban{Kind: db.BanAccount, Value: "u1", ExpiresAt: tt.first},
+				db.Ban{Kind: db.BanAccount, Value: "u1", ExpiresAt: tt.then},
+				db.Ban{Kind: db.BanUsername, Value: skeleton, ExpiresAt: tt.first},
+				db.Ban{Kind: db.BanUsername, Value: skeleton, ExpiresAt: tt.then},
+			)
+			now := banStart.Add(tt.after)
+			if _, ok := list.Match("u1", "", "", now); ok != tt.want {
+				t.Errorf("account banned: %v, want %v", ok, tt.want)
+			}
+			if _, ok := list.Match("", "mallory", "", now); ok != tt.want {
+				t.Errorf("username banned: %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestBanReloadDropsExpired(t *testing.T) {
+	list := loadBans(t,
+		db.Ban{Kind: db.BanAccount, Value: "u1"},
+		db.Ban{Kind: db.BanAccount, Value: "u1", ExpiresAt: banFor(time.Hour)},
+		db.Ban{Kind: db.BanIP, Value: "203.0.113.0/24", ExpiresAt: banFor(time.Hour)},
+	)
+	if n := list.Counts().ActiveBans; n != 3 {
+		t.Errorf("%d active bans, want 3", n)
+	}
+
+	if err := list.Load(banStart.Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := list.Counts().ActiveBans; n != 1 {
+		t.Errorf("%d active bans after the temporary ones expired, want 1", n)
+	}
+	if _, ok := list.Match("u1", "", "", banStart.Add(2*time.Hour)); !ok {
+		t.Error("permanent ban was dropped with the expired one")
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ConnectionInfo describes an open WebSocket connection for operators
+type ConnectionInfo struct {
+	ID              string    `json:"id"`
+	IP              string    `json:"ip"`
+	UserID          string    `json:"userId,omitempty"`
+	Username        string    `json:"username,omitempty"` // Account name, or the guest name once the client has one
+	PlayerID        string    `json:"playerId,omitempty"`
+	GameID          string    `json:"gameId,omitempty"`
+	Role            string    `json:"role"` // guest for connections without a session
+	ProtocolVersion int       `json:"protocolVersion"`
+	Encoding        string    `json:"encoding"`
+	ConnectedAt     time.Time `json:"connectedAt"`
+}
+
+// clients tracks the server's open WebSocket connections
+type clients struct {
+	mu    sync.Mutex
+	conns map[string]*wsClient
+	users map[string]int // Open connections per logged-in account
+}
+
+func newClients() *clients {
+	return &clients{
+		conns: make(map[string]*wsClient),
+		users: make(map[string]int),
+	}
+}
+
+func (cs *clients) Add(c *wsClient) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.conns[c.id] = c
+	if c.user != nil {
+		cs.users[c.user.UserID]++
+	}
+}
+
+func (cs *clients) Remove(c *wsClient) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.conns, c.id)
+	if c.user == nil {
+		return
+	}
+	if cs.users[c.user.UserID] <= 1 {
+		delete(cs.users, c.user.UserID)
+		return
+	}
+	cs.users[c.user.UserID]--
+}
+
+// Get returns the connection with the given ID
+func (cs *clients) Get(id string) (*wsClient, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	c, ok := cs.conns[id]
+	return c, ok
+}
+
+// All returns every open connection, oldest first
+func (cs *clients) All() []*wsClient {
+	cs.mu.Lock()
+	all := make([]*wsClient, 0, len(cs.conns))
+	for _, c := range cs.conns {
+		all = append(all, c)
+	}
+	cs.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool { return all[i].connectedAt.Before(all[j].connectedAt) })
+	return all
+}
+
+// IsOnline reports whether the account has at least one open connection
+func (cs *clients) IsOnline(userID string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.users[userID] > 0
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"4-in-a-row/auth"
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+	"4-in-a-row/names"
+)
+
+// Friend statuses besides the lobby's idle, queued and playing
+const (
+	FriendOnline  = "online" // Connected but not in the lobby
+	FriendOffline = "offline"
+)
+
+type FriendRequest struct {
+	Username string `json:"username"`
+}
+
+type FriendEntry struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Status   string `json:"status,omitempty"` // Only for accepted friends
+	Since    string `json:"since"`
+}
+
+// FriendsResponse lists a user's friends and the requests waiting on either side
+type FriendsResponse struct {
+	Friends  []FriendEntry `json:"friends"`
+	Incoming []FriendEntry `json:"incoming"`
+	Outgoing []FriendEntry `json:"outgoing"`
+}
+
+// FriendsHandler lists the caller's friends with their presence (GET /friends)
+func (s *Server) FriendsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	friendships, err := s.Store.ListFriendships(user.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := FriendsResponse{
+		Friends:  make([]FriendEntry, 0),
+		Incoming: make([]FriendEntry, 0),
+		Outgoing: make([]FriendEntry, 0),
+	}
+	for _, f := range friendships {
+		other, err := s.Store.GetUser(f.Other(user.UserID))
+		if err != nil {
+			log.Printf("Skipping friend %s of %s: %v", f.Other(user.UserID), user.UserID, err)
+			continue
+		}
+		entry := FriendEntry{UserID: other.ID, Username: other.Username, Since: f.UpdatedAt.Format(time.RFC3339)}
+
+		switch {
+		case f.Status == db.FriendAccepted:
+			entry.Status = s.friendStatus(other.ID)
+			resp.Friends = append(resp.Friends, entry)
+		case f.AddresseeID == user.UserID:
+			resp.Incoming = append(resp.Incoming, entry)
+		default:
+			resp.Outgoing = append(resp.Outgoing, entry)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AddFriendHandler sends a friend request by username, or accepts the
+// other user's request if they already sent one (POST /friends)
+func (s *Server) AddFriendHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req FriendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		http.Error(w, "Body must be {username}", http.StatusBadRequest)
+		return
+	}
+
+	friend, err := s.Store.GetUserByUsername(names.Clean(req.Username))
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "No user with that username", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case friend.ID == user.UserID:
+		http.Error(w, "You cannot add yourself", http.StatusBadRequest)
+		return
+	}
+
+	blocked, err := s.Store.IsBlocked(user.UserID, friend.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "You cannot add this player", http.StatusForbidden)
+		return
+	}
+
+	existing, err := s.Store.GetFriendship(user.UserID, friend.ID)
+	switch {
+	case err == nil && existing.Status == db.FriendPending && existing.RequesterID == friend.ID:
+		s.acceptFriend(w, friend.ID, user.UserID)
+		return
+	case err == nil:
+		http.Error(w, "Already friends or already requested", http.StatusConflict)
+		return
+	case !errors.Is(err, db.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f := &db.Friendship{RequesterID: user.UserID, AddresseeID: friend.ID, Status: db.FriendPending}
+	if err := s.Store.CreateFriendship(f); err != nil {
+		if errors.Is(err, db.ErrFriendshipExists) {
+			http.Error(w, "Already friends or already requested", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s sent a friend request to %s", user.Username, friend.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(FriendEntry{UserID: friend.ID, Username: friend.Username, Since: f.CreatedAt.Format(time.RFC3339)})
+}
+
+// AcceptFriendHandler accepts a pending request from {userId}
+// (POST /friends/{userId}/accept)
+func (s *Server) AcceptFriendHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	s.acceptFriend(w, r.PathValue("userId"), user.UserID)
+}
+
+// RemoveFriendHandler unfriends {userId}, or cancels or declines a pending
+// request between the two (DELETE /friends/{userId})
+func (s *Server) RemoveFriendHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.Store.DeleteFriendship(user.UserID, r.PathValue("userId"))
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "No friendship with that user", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) acceptFriend(w http.ResponseWriter, requesterID, addresseeID string) {
+	err := s.Store.AcceptFriendship(requesterID, addresseeID)
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "No pending request from that user", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	friend, err := s.Store.GetUser(requesterID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s accepted a friend request from %s", addresseeID, friend.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FriendEntry{
+		UserID:   friend.ID,
+		Username: friend.Username,
+		Status:   s.friendStatus(friend.ID),
+		Since:    time.Now().Format(time.RFC3339),
+	})
+}
+
+// friendStatus is where a friend can be found: their lobby status, playing
+// outside the lobby, connected, or offline
+func (s *Server) friendStatus(userID string) string {
+	if status, ok := s.Lobby.StatusOf(userID); ok {
+		return status
+	}
+	if s.Games.IsUserPlaying(userID) {
+		return game.StatusPlaying
+	}
+	if s.clients.IsOnline(userID) {
+		return FriendOnline
+	}
+	return FriendOffline
+}
+
+// areFriends reports whether two accounts have an accepted friendship
+func (s *Server) areFriends(userID, otherID string) (bool, error) {
+	f, err := s.Store.GetFriendship(userID, otherID)
+	if errors.Is(err, db.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return f.Status == db.FriendAccepted, nil
+}
+
+// requireUser returns the caller's session, answering 401 if there is none
+func (s *Server) requireUser(w http.ResponseWriter, r *http.Request) (*auth.Claims, bool) {
+	if c := callerFrom(r); c != nil {
+		return c.Claims, true
+	}
+	user, err := s.sessionFromRequest(r)
+	if err != nil || user == nil {
+		http.Error(w, "Login required", http.StatusUnauthorized)
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"4-in-a-row/db"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment so proxies
+// keep the connection open
+const sseKeepAlive = 15 * time.Second
+
+// GameEventsHandler streams a game's events as Server-Sent Events
+// (GET /games/{id}/events). Each event's SSE id is its sequence number, so a
+// client resuming with Last-Event-ID only receives what it missed. Finished
+// games are replayed from the store and the stream ends; once a client has
+// seen every event of a finished game it gets 204, which tells EventSource
+// to stop reconnecting.
+func (s *Server) GameEventsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	gameID := r.PathValue("id")
+
+	lastSeq := 0
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		n, err := strconv.Atoi(id)
+		if err != nil || n < 0 {
+			http.Error(w, "Last-Event-ID must be an event sequence number", http.StatusBadRequest)
+			return
+		}
+		lastSeq = n
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var backlog []db.GameEvent
+	var events <-chan db.GameEvent
+	var players []string
+	if g := s.Games.GetGame(gameID); g != nil {
+		var stop func()
+		backlog, events, stop = g.Watch(lastSeq)
+		defer stop()
+		players = []string{g.Player1.UserID, g.Player2.UserID}
+	} else {
+		stored, err := s.Store.GetGameEvents(gameID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(stored) == 0 {
+			http.Error(w, "Game not found", http.StatusNotFound)
+			return
+		}
+		for _, e := range stored {
+			if e.Seq > lastSeq {
+				backlog = append(backlog, e)
+			}
+		}
+		players = eventPlayers(stored)
+	}
+	accounts := s.accountsVisible(r, players)
+
+	if events == nil && len(backlog) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range backlog {
+		if err := writeSSE(w, e, accounts); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	if events == nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, e, accounts); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE writes one game event in the same shape as /game-history entries
+func writeSSE(w http.ResponseWriter, e db.GameEvent, accounts bool) error {
+	data, err := json.Marshal(gameEventResponse(e, accounts))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data)
+	return err
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"4-in-a-row/auth"
+	"4-in-a-row/db"
+)
+
+type GameEventResponse struct {
+	Seq       int              `json:"seq"`
+	Type      string           `json:"type"`
+	Data      db.GameEventData `json:"data"`
+	Timestamp string           `json:"timestamp"`
+}
+
+// GameHistoryHandler returns the ordered event log of a game (?gameId=...)
+func (s *Server) GameHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	gameID := r.URL.Query().Get("gameId")
+	if gameID == "" {
+		http.Error(w, "gameId is required", http.StatusBadRequest)
+		return
+	}
+
+	events, err := s.Store.GetGameEvents(gameID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(events) == 0 {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	accounts := s.accountsVisible(r, eventPlayers(events))
+	response := make([]GameEventResponse, len(events))
+	for i, e := range events {
+		response[i] = gameEventResponse(e, accounts)
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// gameEventResponse is the public form of an event. Players' session IDs are
+// left out: they identify a connection's seat in the game to the server.
+// Account IDs are only kept when accounts is set.
+func gameEventResponse(e db.GameEvent, accounts bool) GameEventResponse {
+	data := e.Data
+	data.Player1 = publicPlayerData(data.Player1, accounts)
+	data.Player2 = publicPlayerData(data.Player2, accounts)
+	return GameEventResponse{
+		Seq:       e.Seq,
+		Type:      e.Type,
+		Data:      data,
+		Timestamp: e.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func publicPlayerData(p *db.PlayerData, accounts bool) *db.PlayerData {
+	if p == nil {
+		return nil
+	}
+	public := *p
+	public.ID = ""
+	if !accounts {
+		public.UserID = ""
+	}
+	return &public
+}
+
+// accountsVisible reports whether the caller may see which accounts played a
+// game: the players themselves and moderators may, anyone else only gets
+// usernames
+func (s *Server) accountsVisible(r *http.Request, players []string) bool {
+	claims, err := s.sessionFromRequest(r)
+	if err != nil || claims == nil {
+		return false
+	}
+	for _, userID := range players {
+		if userID != "" && userID == claims.UserID {
+			return true
+		}
+	}
+	role, err := s.roleOf(claims.UserID)
+	return err == nil && role.Can(auth.PermModerate)
+}
+
+// eventPlayers returns the account IDs of the players named in events
+func eventPlayers(events []db.GameEvent) []string {
+	var players []string
+	for _, e := range events {
+		for _, p := range []*db.PlayerData{e.Data.Player1, e.Data.Player2} {
+			if p != nil && p.UserID != "" {
+				players = append(players, p.UserID)
+			}
+		}
+	}
+	return players
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"4-in-a-row/auth"
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+)
+
+func TestGameHistoryShowsAccountsToPlayersAndStaff(t *testing.T) {
+	s, ts := newTestServer(t, testConfig(), nil)
+	for _, u := range []*db.User{
+		{ID: "u1", Username: "alice"},
+		{ID: "u2", Username: "bob"},
+		{ID: "u3", Username: "carol"},
+		{ID: "u4", Username: "mod", Role: string(auth.RoleModerator)},
+	} {
+		if err := s.Store.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Store.AppendGameEvent(db.GameEvent{GameID: "g1", Seq: 1, Type: game.EventCreated, Data: db.GameEventData{
+		Player1: &db.PlayerData{ID: "p1", UserID: "u1", Username: "alice", Symbol: 1, Type: "human"},
+		Player2: &db.PlayerData{ID: "p2", UserID: "u2", Username: "bob", Symbol: 2, Type: "human"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		userID   string
+		accounts bool
+	}{
+		{"anonymous", "", false},
+		{"player", "u1", true},
+		{"opponent", "u2", true},
+		{"outsider", "u3", false},
+		{"moderator", "u4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL+"/game-history?gameId=g1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.userID != "" {
+				token, _, err := s.Sessions.Issue(tt.userID, tt.name, time.Now())
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var events []GameEventResponse
+			if err := json.NewDecoder(resp.Body).Decode(&events); err != nil || len(events) != 1 {
+				t.Fatalf("got %d events: %v", len(events), err)
+			}
+			data := events[0].Data
+			if data.Player1.ID != "" || data.Player2.ID != "" {
+				t.Error("session player IDs were exposed")
+			}
+			if got := data.Player1.UserID == "u1" && data.Player2.UserID == "u2"; got != tt.accounts {
+				t.Errorf("account IDs %q and %q shown: %v, want %v", data.Player1.UserID, data.Player2.UserID, got, tt.accounts)
+			}
+		})
+	}
+}
@@ -12,7 +12,7 @@ type HealthResponse struct {
 }
 
 // HealthHandler returns 200 OK if server is running
-func HealthHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	response := HealthResponse{
 		Status:  "ok",
 		Message: "Four in a Row server is running",
@@ -3,8 +3,6 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-
-	"4-in-a-row/db"
 )
 
 type LeaderboardEntry struct {
@@ -12,31 +10,19 @@ type LeaderboardEntry struct {
 	Wins   int64  `json:"wins"`
 }
 
-func LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) LeaderboardHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	if db.DB == nil {
-		http.Error(w, "Database not initialized", http.StatusInternalServerError)
-		return
-	}
-
-	var results []LeaderboardEntry
-	err := db.DB.Model(&db.GameResult{}).
-		Select("winner, count(*) as wins").
-		Where("winner != ?", "draw").
-		Group("winner").
-		Order("wins desc").
-		Limit(10).
-		Scan(&results).Error
-
+	winners, err := s.Store.TopWinners(10)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Return empty array if no results (avoid null in JSON)
-	if results == nil {
-		results = []LeaderboardEntry{}
+	results := make([]LeaderboardEntry, 0, len(winners))
+	for _, wc := range winners {
+		results = append(results, LeaderboardEntry{Winner: wc.Winner, Wins: wc.Wins})
 	}
 
 	json.NewEncoder(w).Encode(results)
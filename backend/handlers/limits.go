@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"4-in-a-row/config"
+)
+
+// rateLimitStrikes is how many rate-limited messages a connection may send
+// before it is closed
+const rateLimitStrikes = 3
+
+// tokenBucket allows rate events per second with bursts of up to burst
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// Allow takes a token if one is available
+func (b *tokenBucket) Allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return true
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// LimitCounts counts inbound limit violations since the server started
+type LimitCounts struct {
+	OversizedMessages   int64 `json:"oversizedMessages"`
+	RateLimitedMessages int64 `json:"rateLimitedMessages"`
+	RejectedConnections int64 `json:"rejectedConnections"`
+	ClosedConnections   int64 `json:"closedConnections"` // Closed for repeatedly exceeding the rate
+}
+
+// limiter enforces the inbound WebSocket limits shared by all connections
+type limiter struct {
+	cfg *config.Config
+
+	mu    sync.Mutex
+	conns map[string]int          // Open connections per IP
+	ips   map[string]*tokenBucket // Message rate per IP, kept while the IP has connections
+
+	oversized   atomic.Int64
+	rateLimited atomic.Int64
+	rejected    atomic.Int64
+	closed      atomic.Int64
+}
+
+func newLimiter(cfg *config.Config) *limiter {
+	return &limiter{
+		cfg:   cfg,
+		conns: make(map[string]int),
+		ips:   make(map[string]*tokenBucket),
+	}
+}
+
+// Open registers a connection from ip and returns its IP bucket; ok is false
+// if ip already has as many connections as allowed
+func (l *limiter) Open(ip string, now time.Time) (bucket *tokenBucket, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.WSMaxConnsPerIP > 0 && l.conns[ip] >= l.cfg.WSMaxConnsPerIP {
+		l.rejected.Add(1)
+		return nil, false
+	}
+
+	l.conns[ip]++
+	bucket = l.ips[ip]
+	if bucket == nil {
+		bucket = newTokenBucket(l.cfg.WSIPMessageRate, l.cfg.WSIPMessageBurst, now)
+		l.ips[ip] = bucket
+	}
+	return bucket, true
+}
+
+// Close releases a connection registered with Open
+func (l *limiter) Close(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conns[ip]--
+	if l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+		delete(l.ips, ip)
+	}
+}
+
+// Counts returns the violation counters
+func (l *limiter) Counts() LimitCounts {
+	return LimitCounts{
+		OversizedMessages:   l.oversized.Load(),
+		RateLimitedMessages: l.rateLimited.Load(),
+		RejectedConnections: l.rejected.Load(),
+		ClosedConnections:   l.closed.Load(),
+	}
+}
+
+// clientIP returns the address limits and bans are applied to. Behind hops
+// trusted proxies, each appends the address it received the request from to
+// X-Forwarded-For, so the client's address is hops entries from the right;
+// anything further left was sent by the client and is ignored.
+func clientIP(r *http.Request, trustProxy bool, hops int) string {
+	if trustProxy && hops > 0 {
+		var entries []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(header, ",") {
+				entries = append(entries, strings.TrimSpace(entry))
+			}
+		}
+		if len(entries) > 0 {
+			// Fewer entries than proxies means the request skipped the outer
+			// ones, so every entry is still one a trusted proxy added
+			i := len(entries) - hops
+			if i < 0 {
+				i = 0
+			}
+			if net.ParseIP(entries[i]) != nil {
+				return entries[i]
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"4-in-a-row/config"
+	"4-in-a-row/game"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		forwarded  []string
+		trustProxy bool
+		hops       int
+		want       string
+	}{
+		{"proxy headers ignored", []string{"203.0.113.9"}, false, 1, "10.0.0.1"},
+		{"no header", nil, true, 1, "10.0.0.1"},
+		{"single proxy", []string{"203.0.113.9"}, true, 1, "203.0.113.9"},
+		{"spoofed entry ignored", []string{"1.2.3.4, 203.0.113.9"}, true, 1, "203.0.113.9"},
+		{"two proxies", []string{"1.2.3.4, 203.0.113.9, 10.0.0.2"}, true, 2, "203.0.113.9"},
+		{"repeated headers", []string{"1.2.3.4", "203.0.113.9"}, true, 1, "203.0.113.9"},
+		{"fewer entries than hops", []string{"203.0.113.9"}, true, 2, "203.0.113.9"},
+		{"garbage", []string{"not-an-ip"}, true, 1, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws", nil)
+			r.RemoteAddr = "10.0.0.1:5000"
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r, tt.trustProxy, tt.hops); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+var limitsStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestTokenBucketBurstAndRefill(t *testing.T) {
+	now := limitsStart
+	b := newTokenBucket(2, 3, now)
+
+	for i := 0; i < 3; i++ {
+		if !b.Allow(now) {
+			t.Fatalf("message %d of the burst was refused", i+1)
+		}
+	}
+	if b.Allow(now) {
+		t.Fatal("bucket allowed more than its burst")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !b.Allow(now) {
+		t.Fatal("bucket did not refill at its rate")
+	}
+	if b.Allow(now) {
+		t.Fatal("bucket refilled faster than its rate")
+	}
+
+	// An idle bucket fills up to its burst and no further
+	now = now.Add(time.Minute)
+	for i := 0; i < 3; i++ {
+		if !b.Allow(now) {
+			t.Fatalf("message %d after idling was refused", i+1)
+		}
+	}
+	if b.Allow(now) {
+		t.Error("idle bucket filled past its burst")
+	}
+}
+
+func TestTokenBucketWithoutRateIsUnlimited(t *testing.T) {
+	b := newTokenBucket(0, 0, limitsStart)
+	for i := 0; i < 100; i++ {
+		if !b.Allow(limitsStart) {
+			t.Fatal("bucket with no rate refused a message")
+		}
+	}
+}
+
+func TestLimiterCapsConnectionsPerIP(t *testing.T) {
+	l := newLimiter(&config.Config{WSMaxConnsPerIP: 2})
+
+	for i := 0; i < 2; i++ {
+		if _, ok := l.Open("10.0.0.1", limitsStart); !ok {
+			t.Fatalf("connection %d was refused", i+1)
+		}
+	}
+	if _, ok := l.Open("10.0.0.1", limitsStart); ok {
+		t.Fatal("connection over the cap was accepted")
+	}
+	if _, ok := l.Open("10.0.0.2", limitsStart); !ok {
+		t.Fatal("another IP was refused")
+	}
+	if n := l.Counts().RejectedConnections; n != 1 {
+		t.Errorf("counted %d rejected connections, want 1", n)
+	}
+
+	l.Close("10.0.0.1")
+	if _, ok := l.Open("10.0.0.1", limitsStart); !ok {
+		t.Error("closing a connection did not release its slot")
+	}
+}
+
+func TestLimiterSharesRateAcrossConnections(t *testing.T) {
+	l := newLimiter(&config.Config{WSIPMessageRate: 1, WSIPMessageBurst: 2})
+
+	first, _ := l.Open("10.0.0.1", limitsStart)
+	second, _ := l.Open("10.0.0.1", limitsStart)
+	if first != second {
+		t.Fatal("connections from one IP got separate buckets")
+	}
+	other, _ := l.Open("10.0.0.2", limitsStart)
+	if other == first {
+		t.Fatal("different IPs share a bucket")
+	}
+
+	first.Allow(limitsStart)
+	second.Allow(limitsStart)
+	if first.Allow(limitsStart) {
+		t.Error("IP went over its rate by spreading messages over connections")
+	}
+
+	// The bucket lasts while the IP has connections and starts full after
+	l.Close("10.0.0.1")
+	if again, _ := l.Open("10.0.0.1", limitsStart); again != first {
+		t.Error("IP bucket was dropped while a connection was open")
+	}
+	l.Close("10.0.0.1")
+	l.Close("10.0.0.1")
+	if fresh, _ := l.Open("10.0.0.1", limitsStart); fresh == first || !fresh.Allow(limitsStart) {
+		t.Error("IP bucket outlived the IP's connections")
+	}
+}
+
+func TestIPMessageRateOverWebSocket(t *testing.T) {
+	clock := game.NewFakeClock(limitsStart)
+	cfg := testConfig()
+	cfg.WSIPMessageRate = 1
+	cfg.WSIPMessageBurst = 2
+	_, ts := newTestServer(t, cfg, clock)
+	first, second := dialWS(t, ts, ""), dialWS(t, ts, "")
+
+	request(t, first, "1", "LEAVE_QUEUE", nil)
+	request(t, second, "2", "LEAVE_QUEUE", nil)
+	if _, payload := reply(t, first, "1"); payload["code"] == game.ErrCodeRateLimited {
+		t.Fatal("first message was rate limited")
+	}
+	if _, payload := reply(t, second, "2"); payload["code"] == game.ErrCodeRateLimited {
+		t.Fatal("second message was rate limited")
+	}
+
+	request(t, second, "3", "LEAVE_QUEUE", nil)
+	if _, payload := reply(t, second, "3"); payload["code"] != game.ErrCodeRateLimited {
+		t.Fatalf("third message from the IP got %v, want RATE_LIMITED", payload["code"])
+	}
+
+	clock.Advance(time.Second)
+	request(t, first, "4", "LEAVE_QUEUE", nil)
+	if _, payload := reply(t, first, "4"); payload["code"] == game.ErrCodeRateLimited {
+		t.Error("IP bucket did not refill")
+	}
+}
+
+func TestConnectionCapReleasedOnClose(t *testing.T) {
+	cfg := testConfig()
+	cfg.WSMaxConnsPerIP = 1
+	s, ts := newTestServer(t, cfg, nil)
+
+	first := dialWS(t, ts, "")
+	refused := dialWS(t, ts, "")
+	readType(t, refused, "ERROR")
+	if _, _, err := refused.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("connection over the cap ended with %v, want a policy violation close", err)
+	}
+
+	first.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.limits.mu.Lock()
+		open := len(s.limits.conns)
+		s.limits.mu.Unlock()
+		if open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("closed connection still counts against the cap")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn := dialWS(t, ts, "")
+	request(t, conn, "1", "LEAVE_QUEUE", nil)
+	if _, payload := reply(t, conn, "1"); payload["code"] != game.ErrCodeNotInQueue {
+		t.Errorf("connection after close got %v, want its request handled", payload["code"])
+	}
+}
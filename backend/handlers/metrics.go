@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
-
-	"4-in-a-row/db"
 )
 
 // GameMetricsResponse represents the overall game analytics
@@ -15,6 +13,8 @@ type GameMetricsResponse struct {
 	AverageDuration float64          `json:"averageDuration"`
 	GamesToday      int              `json:"gamesToday"`
 	RecentActivity  []HourlyActivity `json:"recentActivity"`
+	Limits          LimitCounts      `json:"limits"` // Inbound WebSocket limit violations
+	Bans            BanCounts        `json:"bans"`
 }
 
 type HourlyActivity struct {
@@ -23,40 +23,26 @@ type HourlyActivity struct {
 	AverageDuration float64 `json:"averageDuration"`
 }
 
-func GameMetricsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GameMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	// Enable CORS
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
 
-	if db.DB == nil {
-		http.Error(w, "Database not initialized", http.StatusInternalServerError)
+	// Get totals and games today
+	today := time.Now().Truncate(24 * time.Hour)
+	summary, err := s.Store.GetGameSummary(today)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Get total games
-	var totalGames int64
-	db.DB.Model(&db.GameResult{}).Count(&totalGames)
-
-	// Get total unique players
-	var totalPlayers int64
-	db.DB.Model(&db.PlayerStats{}).Count(&totalPlayers)
-
-	// Get average duration (use COALESCE to handle NULL when no games exist)
-	var avgDuration float64
-	db.DB.Model(&db.GameResult{}).Select("COALESCE(AVG(duration), 0)").Scan(&avgDuration)
-
-	// Get games today
-	today := time.Now().Truncate(24 * time.Hour)
-	var gamesToday int64
-	db.DB.Model(&db.GameResult{}).Where("created_at >= ?", today).Count(&gamesToday)
-
 	// Get recent hourly activity (last 24 hours)
-	var recentMetrics []db.GameMetrics
 	yesterday := time.Now().Add(-24 * time.Hour)
-	db.DB.Where("date >= ?", yesterday.Truncate(24*time.Hour)).
-		Order("date DESC, hour DESC").
-		Limit(24).
-		Find(&recentMetrics)
+	recentMetrics, err := s.Store.RecentMetrics(yesterday.Truncate(24*time.Hour), 24)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// Convert to response format
 	recentActivity := make([]HourlyActivity, 0, len(recentMetrics))
@@ -69,11 +55,13 @@ func GameMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := GameMetricsResponse{
-		TotalGames:      int(totalGames),
-		TotalPlayers:    int(totalPlayers),
-		AverageDuration: avgDuration,
-		GamesToday:      int(gamesToday),
+		TotalGames:      int(summary.TotalGames),
+		TotalPlayers:    int(summary.TotalPlayers),
+		AverageDuration: summary.AverageDuration,
+		GamesToday:      int(summary.GamesToday),
 		RecentActivity:  recentActivity,
+		Limits:          s.limits.Counts(),
+		Bans:            s.bans.Counts(),
 	}
 
 	json.NewEncoder(w).Encode(response)
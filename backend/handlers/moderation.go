@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"4-in-a-row/db"
+	"4-in-a-row/names"
+)
+
+// ReportReasons are the reasons a player can give for reporting an opponent
+var ReportReasons = []string{"abuse", "cheating", "stalling", "other"}
+
+// maxReportDetails bounds the free-text part of a report
+const maxReportDetails = 2000
+
+type BlockRequest struct {
+	Username string `json:"username"`
+}
+
+type BlockEntry struct {
+	UserID    string `json:"userId"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// ReportRequest is the body of POST /reports
+type ReportRequest struct {
+	GameID  string `json:"gameId"`
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+// ReportResponse is a report as shown to its reporter and to moderators
+type ReportResponse struct {
+	ID           uint          `json:"id"`
+	GameID       string        `json:"gameId"`
+	ReporterID   string        `json:"reporterId"`
+	ReporterName string        `json:"reporterName"`
+	ReportedID   string        `json:"reportedId,omitempty"`
+	ReportedName string        `json:"reportedName"`
+	Reason       string        `json:"reason"`
+	Details      string        `json:"details,omitempty"`
+	Moves        []db.MoveData `json:"moves,omitempty"`
+	Status       string        `json:"status"`
+	Resolution   string        `json:"resolution,omitempty"`
+	ResolvedBy   string        `json:"resolvedBy,omitempty"`
+	ResolvedAt   string        `json:"resolvedAt,omitempty"`
+	CreatedAt    string        `json:"createdAt"`
+}
+
+// BlocksHandler lists the accounts the caller has blocked (GET /blocks)
+func (s *Server) BlocksHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	blocks, err := s.Store.ListBlocks(user.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries := make([]BlockEntry, 0, len(blocks))
+	for _, b := range blocks {
+		entry := BlockEntry{UserID: b.BlockedID, CreatedAt: b.CreatedAt.Format(time.RFC3339)}
+		if blocked, err := s.Store.GetUser(b.BlockedID); err == nil {
+			entry.Username = blocked.Username
+		}
+		entries = append(entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// BlockHandler blocks an account by username and ends any friendship with
+// it (POST /blocks)
+func (s *Server) BlockHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req BlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		http.Error(w, "Body must be {username}", http.StatusBadRequest)
+		return
+	}
+
+	blocked, err := s.Store.GetUserByUsername(names.Clean(req.Username))
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "No user with that username", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	case blocked.ID == user.UserID:
+		http.Error(w, "You cannot block yourself", http.StatusBadRequest)
+		return
+	}
+
+	b := &db.Block{BlockerID: user.UserID, BlockedID: blocked.ID}
+	if err := s.Store.CreateBlock(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := s.Store.DeleteFriendship(user.UserID, blocked.ID); err != nil && !errors.Is(err, db.ErrNotFound) {
+		log.Printf("Failed to remove friendship of %s and %s after block: %v", user.UserID, blocked.ID, err)
+	}
+	log.Printf("User %s blocked %s", user.Username, blocked.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(BlockEntry{UserID: blocked.ID, Username: blocked.Username, CreatedAt: time.Now().Format(time.RFC3339)})
+}
+
+// UnblockHandler lifts the caller's block of {userId} (DELETE /blocks/{userId})
+func (s *Server) UnblockHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.Store.DeleteBlock(user.UserID, r.PathValue("userId"))
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "You have not blocked that user", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ReportHandler reports the caller's opponent in a finished game
+// (POST /reports). The game's moves are attached from its stored result.
+// There is no chat log to attach: the server does not offer FeatureChat and
+// keeps no chat messages, so chat moderation is out of scope until it does.
+func (s *Server) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GameID == "" {
+		http.Error(w, "Body must be {gameId, reason, details}", http.StatusBadRequest)
+		return
+	}
+	if !contains(ReportReasons, req.Reason) {
+		http.Error(w, "Reason must be one of abuse, cheating, stalling, other", http.StatusBadRequest)
+		return
+	}
+	if len(req.Details) > maxReportDetails {
+		http.Error(w, "Details must be at most 2000 characters", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.Store.GetGameResult(req.GameID)
+	if err != nil {
+		http.Error(w, "Game not found or not finished", http.StatusNotFound)
+		return
+	}
+
+	var reporter, reported db.PlayerData
+	switch user.UserID {
+	case result.Player1.UserID:
+		reporter, reported = result.Player1, result.Player2
+	case result.Player2.UserID:
+		reporter, reported = result.Player2, result.Player1
+	default:
+		http.Error(w, "You did not play in that game", http.StatusForbidden)
+		return
+	}
+	if reported.Type == "bot" {
+		http.Error(w, "Bots cannot be reported", http.StatusBadRequest)
+		return
+	}
+
+	already, err := s.Store.HasReported(user.UserID, req.GameID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if already {
+		http.Error(w, "You already reported this game", http.StatusConflict)
+		return
+	}
+
+	report := &db.Report{
+		GameID:       req.GameID,
+		ReporterID:   user.UserID,
+		ReporterName: reporter.Username,
+		ReportedID:   reported.UserID,
+		ReportedName: reported.Username,
+		Reason:       req.Reason,
+		Details:      req.Details,
+		Moves:        result.Moves,
+	}
+	if err := s.Store.CreateReport(report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s reported %s in game %s (%s)", reporter.Username, reported.Username, req.GameID, req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reportResponse(report))
+}
+
+func reportResponse(r *db.Report) ReportResponse {
+	resp := ReportResponse{
+		ID:           r.ID,
+		GameID:       r.GameID,
+		ReporterID:   r.ReporterID,
+		ReporterName: r.ReporterName,
+		ReportedID:   r.ReportedID,
+		ReportedName: r.ReportedName,
+		Reason:       r.Reason,
+		Details:      r.Details,
+		Moves:        r.Moves,
+		Status:       r.Status,
+		Resolution:   r.Resolution,
+		ResolvedBy:   r.ResolvedBy,
+		CreatedAt:    r.CreatedAt.Format(time.RFC3339),
+	}
+	if r.ResolvedAt != nil {
+		resp.ResolvedAt = r.ResolvedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
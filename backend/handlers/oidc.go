@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"4-in-a-row/auth"
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+	"4-in-a-row/names"
+	"4-in-a-row/oidc"
+
+	"github.com/google/uuid"
+)
+
+// oidcFlowTTL is how long a player has to log in at the provider
+const oidcFlowTTL = 10 * time.Minute
+
+// oidcCookie holds the signed state of a login in progress
+const oidcCookie = "oidc_flow"
+
+// OIDCStartResponse is the response of POST /auth/oidc/link
+type OIDCStartResponse struct {
+	URL string `json:"url"` // Send the browser here
+}
+
+// OIDCLoginHandler starts a login through the OpenID Connect provider by
+// redirecting to it (GET /auth/oidc/login). A login_hint is passed on.
+func (s *Server) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireOIDC(w) {
+		return
+	}
+
+	authURL, err := s.startOIDC(w, r, "")
+	if err != nil {
+		log.Printf("Failed to start OIDC login: %v", err)
+		s.oidcFail(w, r, http.StatusBadGateway, &game.ProtocolError{Code: game.ErrCodeOIDCFailed, Message: "Login provider unavailable"})
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCLinkHandler starts linking the caller's account to an identity at the
+// provider (POST /auth/oidc/link). The browser must then be sent to the
+// returned URL with the cookie this response sets.
+func (s *Server) OIDCLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireOIDC(w) {
+		return
+	}
+	user, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	authURL, err := s.startOIDC(w, r, user.UserID)
+	if err != nil {
+		log.Printf("Failed to start OIDC link for %s: %v", user.Username, err)
+		writeError(w, http.StatusBadGateway, &game.ProtocolError{Code: game.ErrCodeOIDCFailed, Message: "Login provider unavailable"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OIDCStartResponse{URL: authURL})
+}
+
+// OIDCCallbackHandler finishes a login or link when the provider sends the
+// browser back (GET /auth/oidc/callback). New identities get a new account
+// named after their preferred username.
+func (s *Server) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireOIDC(w) {
+		return
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		s.oidcFail(w, r, http.StatusUnauthorized, &game.ProtocolError{Code: game.ErrCodeOIDCFailed, Message: "Login refused by provider: " + e})
+		return
+	}
+
+	flow, err := s.oidcFlow(r)
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/auth/oidc", MaxAge: -1, HttpOnly: true})
+	if err != nil || subtle.ConstantTimeCompare([]byte(flow.State), []byte(q.Get("state"))) != 1 {
+		s.oidcFail(w, r, http.StatusBadRequest, &game.ProtocolError{Code: game.ErrCodeOIDCFailed, Message: "Login expired or was started elsewhere; please try again"})
+		return
+	}
+
+	token, err := s.OIDC.Exchange(r.Context(), q.Get("code"), flow.Verifier, flow.Nonce, time.Now())
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		s.oidcFail(w, r, http.StatusBadGateway, &game.ProtocolError{Code: game.ErrCodeOIDCFailed, Message: "Could not verify the login with the provider"})
+		return
+	}
+
+	var user *db.User
+	if flow.LinkUserID != "" {
+		user, err = s.linkIdentity(flow.LinkUserID, token)
+	} else {
+		user, err = s.identityUser(token)
+	}
+	var perr *game.ProtocolError
+	switch {
+	case errors.As(err, &perr):
+		s.oidcFail(w, r, http.StatusConflict, perr)
+		return
+	case err != nil:
+		log.Printf("OIDC login for %s failed: %v", token.Subject, err)
+		s.oidcFail(w, r, http.StatusInternalServerError, &game.ProtocolError{Code: game.ErrCodeInternal, Message: "Login failed, please try again"})
+		return
+	}
+
+	if s.Config.OIDCSuccessURL == "" {
+		s.writeSession(w, http.StatusOK, user)
+		return
+	}
+	session, expiresAt, err := s.Sessions.Issue(user.ID, user.Username, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fragment := url.Values{"token": {session}, "expiresAt": {expiresAt.Format(time.RFC3339)}}
+	http.Redirect(w, r, s.Config.OIDCSuccessURL+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// startOIDC sets the flow cookie and returns the provider's login URL
+func (s *Server) startOIDC(w http.ResponseWriter, r *http.Request, linkUserID string) (string, error) {
+	var flow auth.OIDCFlowClaims
+	var err error
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		if *v, err = oidc.RandomString(); err != nil {
+			return "", err
+		}
+	}
+	flow.LinkUserID = linkUserID
+
+	authURL, err := s.OIDC.AuthURL(r.Context(), flow.State, flow.Nonce, flow.Verifier, r.URL.Query().Get("login_hint"))
+	if err != nil {
+		return "", err
+	}
+	signed, err := s.oidcFlows.IssueOIDCFlow(flow, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    signed,
+		Path:     "/auth/oidc",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(s.Config.OIDCRedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode, // Sent on the provider's top-level redirect back
+	})
+	return authURL, nil
+}
+
+func (s *Server) oidcFlow(r *http.Request) (auth.OIDCFlowClaims, error) {
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return auth.OIDCFlowClaims{}, err
+	}
+	return s.oidcFlows.VerifyOIDCFlow(cookie.Value, time.Now())
+}
+
+// identityUser returns the account linked to the token's identity, creating
+// one for an identity seen for the first time
+func (s *Server) identityUser(token *oidc.IDToken) (*db.User, error) {
+	identity, err := s.Store.GetIdentity(s.OIDC.Issuer(), token.Subject)
+	if err == nil {
+		return s.Store.GetUser(identity.UserID)
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		return nil, err
+	}
+
+	user, err := s.createOIDCUser(token)
+	if errors.Is(err, db.ErrIdentityLinked) {
+		// Another callback for the same identity got there first
+		if identity, err = s.Store.GetIdentity(s.OIDC.Issuer(), token.Subject); err != nil {
+			return nil, err
+		}
+		return s.Store.GetUser(identity.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Registered user %s (%s) from OIDC subject %s", user.Username, user.ID, token.Subject)
+	return user, nil
+}
+
+// linkIdentity links the token's identity to an existing account
+func (s *Server) linkIdentity(userID string, token *oidc.IDToken) (*db.User, error) {
+	user, err := s.Store.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &db.Identity{UserID: user.ID, Issuer: s.OIDC.Issuer(), Subject: token.Subject, Email: token.Email}
+	err = s.Store.CreateIdentity(identity)
+	if errors.Is(err, db.ErrIdentityLinked) {
+		existing, lookupErr := s.Store.GetIdentity(s.OIDC.Issuer(), token.Subject)
+		if lookupErr == nil && existing.UserID == user.ID {
+			return user, nil
+		}
+		return nil, &game.ProtocolError{Code: game.ErrCodeIdentityLinked, Message: "That login is already linked to another account"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Linked user %s to OIDC subject %s", user.Username, token.Subject)
+	return user, nil
+}
+
+// createOIDCUser registers an account without a password for a new
+// identity, linked to it in the same transaction. The name comes from the
+// first of the preferred username, name and email that passes the username
+// policy, with a number added if it is taken.
+func (s *Server) createOIDCUser(token *oidc.IDToken) (*db.User, error) {
+	emailName, _, _ := strings.Cut(token.Email, "@")
+	for _, candidate := range []string{token.PreferredUsername, token.Name, emailName, "player"} {
+		base, err := s.checkUsername(candidate)
+		if err != nil {
+			continue
+		}
+
+		for n := 1; n <= 20; n++ {
+			username := base
+			if n > 1 {
+				suffix := fmt.Sprint(n)
+				username = truncate(base, names.MaxLength-len(suffix)) + suffix
+			}
+			if username, err = s.checkUsername(username); err != nil {
+				break
+			}
+
+			user := &db.User{ID: uuid.New().String(), Username: username}
+			identity := &db.Identity{Issuer: s.OIDC.Issuer(), Subject: token.Subject, Email: token.Email}
+			err = s.Store.CreateUserWithIdentity(user, identity)
+			if err == nil {
+				return user, nil
+			}
+			if !errors.Is(err, db.ErrUsernameTaken) {
+				return nil, err
+			}
+		}
+	}
+	return nil, errors.New("no free username for identity")
+}
+
+func (s *Server) requireOIDC(w http.ResponseWriter) bool {
+	if s.OIDC == nil {
+		http.Error(w, "OIDC login is not configured", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// oidcFail reports a failed callback on the frontend page when there is
+// one, since the browser arrived by redirect
+func (s *Server) oidcFail(w http.ResponseWriter, r *http.Request, status int, perr *game.ProtocolError) {
+	if s.Config.OIDCSuccessURL == "" {
+		writeError(w, status, perr)
+		return
+	}
+	fragment := url.Values{"error": {perr.Code}, "message": {perr.Message}}
+	http.Redirect(w, r, s.Config.OIDCSuccessURL+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimRight(string(runes[:n]), " _-.")
+}
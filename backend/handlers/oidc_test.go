@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"4-in-a-row/config"
+	"4-in-a-row/db"
+	"4-in-a-row/oidc/mockidp"
+)
+
+// newOIDCServer serves a Server whose OIDC login goes through a mock
+// provider, and returns a client that follows the login redirects
+func newOIDCServer(t *testing.T) (*Server, *httptest.Server, *http.Client) {
+	t.Helper()
+
+	idp, err := mockidp.New("four-in-a-row", "client-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idpServer := httptest.NewServer(idp)
+	t.Cleanup(idpServer.Close)
+	idp.Issuer = idpServer.URL
+
+	// The redirect URL must be known before the server is built
+	var routes http.Handler
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routes.ServeHTTP(w, r)
+	}))
+	t.Cleanup(app.Close)
+
+	cfg := &config.Config{
+		AuthSecret:       []byte("secret"),
+		SessionTTL:       time.Hour,
+		OIDCIssuer:       idpServer.URL,
+		OIDCClientID:     "four-in-a-row",
+		OIDCClientSecret: "client-secret",
+		OIDCRedirectURL:  app.URL + "/auth/oidc/callback",
+	}
+	s := NewServer(cfg, db.NewMemoryStore(), nil, nil)
+	t.Cleanup(func() { s.Close() })
+	routes = s.Routes()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, app, &http.Client{Jar: jar}
+}
+
+// finishOIDC follows a login or link through the provider and returns the
+// session the callback hands out
+func finishOIDC(t *testing.T, client *http.Client, req *http.Request) SessionResponse {
+	t.Helper()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var perr ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&perr)
+		t.Fatalf("callback answered %d %s: %s", resp.StatusCode, perr.Code, perr.Message)
+	}
+
+	var session SessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func oidcLogin(t *testing.T, app *httptest.Server, client *http.Client, hint string) SessionResponse {
+	t.Helper()
+	req, err := http.NewRequest("GET", app.URL+"/auth/oidc/login?login_hint="+hint, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return finishOIDC(t, client, req)
+}
+
+func TestOIDCLoginCreatesAccountOnce(t *testing.T) {
+	s, app, client := newOIDCServer(t)
+
+	first := oidcLogin(t, app, client, "alice")
+	if first.User.Username != "alice" {
+		t.Errorf("new account is named %q, want alice", first.User.Username)
+	}
+	user, err := s.Store.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("no account was created: %v", err)
+	}
+	identity, err := s.Store.GetIdentity(s.OIDC.Issuer(), "mock|alice")
+	if err != nil || identity.UserID != user.ID {
+		t.Fatalf("identity is not linked to the new account: %+v, %v", identity, err)
+	}
+
+	again := oidcLogin(t, app, client, "alice")
+	if again.User.ID != first.User.ID {
+		t.Errorf("second login got account %s, want %s", again.User.ID, first.User.ID)
+	}
+}
+
+func TestOIDCLoginAvoidsTakenUsername(t *testing.T) {
+	s, app, client := newOIDCServer(t)
+	if err := s.Store.CreateUser(&db.User{ID: "existing", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := oidcLogin(t, app, client, "alice")
+	if session.User.ID == "existing" || session.User.Username != "alice2" {
+		t.Errorf("got account %s named %q, want a new account named alice2", session.User.ID, session.User.Username)
+	}
+}
+
+func TestOIDCLinkExistingAccount(t *testing.T) {
+	s, app, client := newOIDCServer(t)
+	bob := &db.User{ID: "bob-id", Username: "bob"}
+	if err := s.Store.CreateUser(bob); err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := s.Sessions.Issue(bob.ID, bob.Username, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", app.URL+"/auth/oidc/link?login_hint=carol", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var start OIDCStartResponse
+	json.NewDecoder(resp.Body).Decode(&start)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || start.URL == "" {
+		t.Fatalf("link answered %d with URL %q", resp.StatusCode, start.URL)
+	}
+
+	req, err = http.NewRequest("GET", start.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked := finishOIDC(t, client, req); linked.User.ID != bob.ID {
+		t.Fatalf("link logged in as %s, want %s", linked.User.ID, bob.ID)
+	}
+
+	if session := oidcLogin(t, app, client, "carol"); session.User.ID != bob.ID {
+		t.Errorf("login with the linked identity got account %s, want %s", session.User.ID, bob.ID)
+	}
+	if _, err := s.Store.GetUserByUsername("carol"); err == nil {
+		t.Error("linked identity also got an account of its own")
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"4-in-a-row/db"
+	"4-in-a-row/names"
+)
+
+// How much of a player's history a profile shows
+const (
+	profileRecentGames = 10
+	profileOpponents   = 5
+)
+
+// Record is a win/draw/loss count
+type Record struct {
+	Games  int `json:"games"`
+	Wins   int `json:"wins"`
+	Draws  int `json:"draws"`
+	Losses int `json:"losses"`
+}
+
+func (r *Record) add(outcome string) {
+	r.Games++
+	switch outcome {
+	case "win":
+		r.Wins++
+	case "draw":
+		r.Draws++
+	default:
+		r.Losses++
+	}
+}
+
+// Streaks are runs of consecutive results, most recent game first
+type Streaks struct {
+	Current       string `json:"current,omitempty"` // "win", "loss" or "draw"; empty before the first game
+	CurrentLength int    `json:"currentLength"`
+	LongestWin    int    `json:"longestWin"`
+	LongestLoss   int    `json:"longestLoss"`
+}
+
+// OpponentRecord is a player's record against one opponent
+type OpponentRecord struct {
+	Username string `json:"username"`
+	UserID   string `json:"userId,omitempty"`
+	Record
+}
+
+// PlayerProfile is the response of GET /players/{username}. The player
+// moving first is player 1.
+type PlayerProfile struct {
+	Username          string               `json:"username"`
+	UserID            string               `json:"userId,omitempty"` // Empty for guests
+	MemberSince       string               `json:"memberSince,omitempty"`
+	Totals            Record               `json:"totals"`
+	AsPlayer1         Record               `json:"asPlayer1"`
+	AsPlayer2         Record               `json:"asPlayer2"`
+	Streaks           Streaks              `json:"streaks"`
+	TimePlayed        int64                `json:"timePlayed"` // Seconds
+	LastPlayed        string               `json:"lastPlayed,omitempty"`
+	RecentGames       []RecentGameResponse `json:"recentGames"`
+	FrequentOpponents []OpponentRecord     `json:"frequentOpponents"`
+}
+
+// HeadToHeadResponse is the response of GET /players/{a}/vs/{b}, counted
+// from a's side
+type HeadToHeadResponse struct {
+	Player   string               `json:"player"`
+	Opponent string               `json:"opponent"`
+	Record   Record               `json:"record"`
+	Games    []RecentGameResponse `json:"games"`
+}
+
+// PlayerProfileHandler returns a player's record, streaks, recent games and
+// most frequent opponents (GET /players/{username}). Every figure is counted
+// from the stored game results, so they always agree with each other.
+func (s *Server) PlayerProfileHandler(w http.ResponseWriter, r *http.Request) {
+	key, user, ok := s.playerFromPath(w, r, "username")
+	if !ok {
+		return
+	}
+
+	games, err := s.Store.PlayerGames(key, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user == nil && len(games) == 0 {
+		http.Error(w, "Player not found", http.StatusNotFound)
+		return
+	}
+
+	profile := PlayerProfile{
+		Username:          key.Username,
+		UserID:            key.UserID,
+		RecentGames:       make([]RecentGameResponse, 0, profileRecentGames),
+		FrequentOpponents: make([]OpponentRecord, 0, profileOpponents),
+	}
+	if user != nil {
+		profile.MemberSince = user.CreatedAt.Format(time.RFC3339)
+	}
+
+	opponents := make(map[db.PlayerKey]*OpponentRecord)
+	for i, g := range games {
+		me, opponent := g.Player1, g.Player2
+		if !key.Matches(me) {
+			me, opponent = opponent, me
+		}
+		outcome := key.Outcome(g)
+
+		profile.Totals.add(outcome)
+		if me.Symbol == 1 {
+			profile.AsPlayer1.add(outcome)
+		} else {
+			profile.AsPlayer2.add(outcome)
+		}
+		profile.TimePlayed += g.Duration
+
+		if i < profileRecentGames {
+			profile.RecentGames = append(profile.RecentGames, recentGameResponse(g))
+		}
+
+		opponentKey := db.PlayerKey{UserID: opponent.UserID}
+		if opponent.UserID == "" {
+			opponentKey.Username = opponent.Username
+		}
+		rec := opponents[opponentKey]
+		if rec == nil {
+			// Games are newest first, so this is the opponent's latest name
+			rec = &OpponentRecord{Username: opponent.Username, UserID: opponent.UserID}
+			opponents[opponentKey] = rec
+		}
+		rec.add(outcome)
+	}
+	profile.Streaks = streaks(key, games)
+	if len(games) > 0 {
+		profile.LastPlayed = games[0].CreatedAt.Format(time.RFC3339)
+	}
+
+	for _, rec := range opponents {
+		profile.FrequentOpponents = append(profile.FrequentOpponents, *rec)
+	}
+	sort.Slice(profile.FrequentOpponents, func(i, j int) bool {
+		a, b := profile.FrequentOpponents[i], profile.FrequentOpponents[j]
+		if a.Games != b.Games {
+			return a.Games > b.Games
+		}
+		return a.Username < b.Username
+	})
+	if len(profile.FrequentOpponents) > profileOpponents {
+		profile.FrequentOpponents = profile.FrequentOpponents[:profileOpponents]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// HeadToHeadHandler returns the games between two players and a's record
+// against b (GET /players/{a}/vs/{b})
+func (s *Server) HeadToHeadHandler(w http.ResponseWriter, r *http.Request) {
+	a, _, ok := s.playerFromPath(w, r, "a")
+	if !ok {
+		return
+	}
+	b, _, ok := s.playerFromPath(w, r, "b")
+	if !ok {
+		return
+	}
+	if a == b {
+		http.Error(w, "Pick two different players", http.StatusBadRequest)
+		return
+	}
+
+	games, err := s.Store.HeadToHead(a, b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := HeadToHeadResponse{
+		Player:   a.Username,
+		Opponent: b.Username,
+		Games:    make([]RecentGameResponse, 0, len(games)),
+	}
+	for _, g := range games {
+		resp.Record.add(a.Outcome(g))
+		resp.Games = append(resp.Games, recentGameResponse(g))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// playerFromPath resolves a username in the path to an account, or to the
+// guest or bot that played under that name
+func (s *Server) playerFromPath(w http.ResponseWriter, r *http.Request, name string) (db.PlayerKey, *db.User, bool) {
+	username := names.Clean(r.PathValue(name))
+	if username == "" {
+		http.Error(w, "Username required", http.StatusBadRequest)
+		return db.PlayerKey{}, nil, false
+	}
+
+	user, err := s.Store.GetUserByUsername(username)
+	switch {
+	case err == nil:
+		return db.PlayerKey{UserID: user.ID, Username: user.Username}, user, true
+	case errors.Is(err, db.ErrNotFound):
+		return db.PlayerKey{Username: username}, nil, true
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.PlayerKey{}, nil, false
+	}
+}
+
+// streaks walks games newest first
+func streaks(key db.PlayerKey, games []db.GameResult) Streaks {
+	var st Streaks
+	run, runOutcome := 0, ""
+	for i, g := range games {
+		outcome := key.Outcome(g)
+		if outcome == runOutcome {
+			run++
+		} else {
+			run, runOutcome = 1, outcome
+		}
+		if i == 0 {
+			st.Current = outcome
+		}
+		if outcome == st.Current && run == i+1 {
+			st.CurrentLength = run
+		}
+		switch {
+		case outcome == "win" && run > st.LongestWin:
+			st.LongestWin = run
+		case outcome == "loss" && run > st.LongestLoss:
+			st.LongestLoss = run
+		}
+	}
+	return st
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"4-in-a-row/db"
+	"4-in-a-row/names"
 )
 
 type RecentGameResponse struct {
@@ -18,43 +19,46 @@ type RecentGameResponse struct {
 	PlayedAt   string `json:"playedAt"`
 }
 
-func RecentGamesHandler(w http.ResponseWriter, r *http.Request) {
+// RecentGamesHandler lists the last 20 games, or with ?player= the last 20
+// games of that player
+func (s *Server) RecentGamesHandler(w http.ResponseWriter, r *http.Request) {
 	// Enable CORS
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Content-Type", "application/json")
-
-	if db.DB == nil {
-		http.Error(w, "Database not initialized", http.StatusInternalServerError)
-		return
-	}
 
-	// Get recent games (last 20)
 	var games []db.GameResult
-	err := db.DB.Order("created_at DESC").Limit(20).Find(&games).Error
+	var err error
+	if player := names.Clean(r.URL.Query().Get("player")); player != "" {
+		key := db.PlayerKey{Username: player}
+		if user, lookupErr := s.Store.GetUserByUsername(player); lookupErr == nil {
+			key = db.PlayerKey{UserID: user.ID, Username: user.Username}
+		}
+		games, err = s.Store.PlayerGames(key, 20)
+	} else {
+		games, err = s.Store.RecentGames(20)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Return empty array if no games
-	if len(games) == 0 {
-		json.NewEncoder(w).Encode([]RecentGameResponse{})
-		return
-	}
-
-	// Transform to response format
-	response := make([]RecentGameResponse, len(games))
-	for i, game := range games {
-		response[i] = RecentGameResponse{
-			GameID:     game.GameID,
-			Player1:    game.Player1.Username,
-			Player2:    game.Player2.Username,
-			Winner:     game.Winner,
-			Duration:   game.Duration,
-			TotalMoves: len(game.Moves),
-			PlayedAt:   game.CreatedAt.Format(time.RFC3339),
-		}
+	// Return an empty array rather than null if there are no games
+	response := make([]RecentGameResponse, 0, len(games))
+	for _, game := range games {
+		response = append(response, recentGameResponse(game))
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+func recentGameResponse(game db.GameResult) RecentGameResponse {
+	return RecentGameResponse{
+		GameID:     game.GameID,
+		Player1:    game.Player1.Username,
+		Player2:    game.Player2.Username,
+		Winner:     game.Winner,
+		Duration:   game.Duration,
+		TotalMoves: len(game.Moves),
+		PlayedAt:   game.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"4-in-a-row/auth"
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+	"4-in-a-row/names"
+)
+
+// messagePermissions declares what each client message type needs. HELLO
+// is always allowed, and types missing here are unknown.
+var messagePermissions = map[string]auth.Permission{
+	game.MsgJoinQueue:        auth.PermPlay,
+	game.MsgLeaveQueue:       auth.PermPlay,
+	game.MsgReconnect:        auth.PermPlay,
+	game.MsgMove:             auth.PermPlay,
+	game.MsgSync:             auth.PermPlay,
+	game.MsgLobbySubscribe:   auth.PermPlay,
+	game.MsgLobbyUnsubscribe: auth.PermPlay,
+	game.MsgChallengePost:    auth.PermPlay,
+	game.MsgChallengeCancel:  auth.PermPlay,
+	game.MsgChallengeAccept:  auth.PermPlay,
+	game.MsgChallengeDecline: auth.PermPlay,
+	game.MsgChallenge:        auth.PermAccount,
+}
+
+// RoleRequest is the body of PUT /admin/users/{username}/role
+type RoleRequest struct {
+	Role string `json:"role"` // player, moderator or admin
+}
+
+// StaffResponse is an account with a role other than player
+type StaffResponse struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// caller is the account behind a request that passed authorize
+type caller struct {
+	*auth.Claims
+	Role auth.Role
+}
+
+type callerKey struct{}
+
+// handle registers a route that needs perm; an empty perm makes it public
+func (s *Server) handle(mux *http.ServeMux, pattern string, perm auth.Permission, h http.HandlerFunc) {
+	if perm == "" {
+		mux.HandleFunc(pattern, h)
+		return
+	}
+	mux.Handle(pattern, s.authorize(perm, h))
+}
+
+// authorize runs next only for callers whose role has perm, answering 401
+// LOGIN_REQUIRED or 403 PERMISSION_DENIED otherwise. The caller is stored
+// in the request context for next.
+func (s *Server) authorize(perm auth.Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := s.sessionFromRequest(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, &game.ProtocolError{Code: game.ErrCodeLoginRequired, Message: "Invalid session token"})
+			return
+		}
+
+		// The account is loaded on every request so that deleted accounts
+		// lose access straight away, not when their token expires
+		role := auth.RoleGuest
+		if claims != nil {
+			role, err = s.roleOf(claims.UserID)
+			if errors.Is(err, db.ErrNotFound) {
+				writeError(w, http.StatusUnauthorized, &game.ProtocolError{Code: game.ErrCodeLoginRequired, Message: "Account no longer exists"})
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if !role.Can(perm) {
+			if claims == nil {
+				writePermissionError(w, http.StatusUnauthorized, loginRequired(perm), "")
+				return
+			}
+			log.Printf("Denied %s %s to %s (%s): needs %s", r.Method, r.URL.Path, claims.Username, role, perm)
+			writePermissionError(w, http.StatusForbidden, permissionDenied(perm), role)
+			return
+		}
+
+		ctx := r.Context()
+		if claims != nil {
+			ctx = context.WithValue(ctx, callerKey{}, &caller{Claims: claims, Role: role})
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// callerFrom returns the account that authorize let through, if any
+func callerFrom(r *http.Request) *caller {
+	c, _ := r.Context().Value(callerKey{}).(*caller)
+	return c
+}
+
+// roleOf looks up an account's current role. Roles are not kept in session
+// tokens so that changing one takes effect straight away.
+func (s *Server) roleOf(userID string) (auth.Role, error) {
+	user, err := s.Store.GetUser(userID)
+	if err != nil {
+		return "", err
+	}
+	return auth.AccountRole(user.Role), nil
+}
+
+// checkMessage refuses client messages the connection's role does not allow
+func (c *wsClient) checkMessage(msgType string) error {
+	perm, ok := messagePermissions[msgType]
+	if !ok {
+		return nil
+	}
+	role := c.currentRole()
+	if role.Can(perm) {
+		return nil
+	}
+	if c.user == nil {
+		return loginRequired(perm)
+	}
+	return permissionDenied(perm)
+}
+
+func loginRequired(perm auth.Permission) *game.ProtocolError {
+	return &game.ProtocolError{Code: game.ErrCodeLoginRequired, Message: "Log in to do that", Permission: string(perm)}
+}
+
+func permissionDenied(perm auth.Permission) *game.ProtocolError {
+	return &game.ProtocolError{Code: game.ErrCodePermissionDenied, Message: "Your role does not allow that", Permission: string(perm)}
+}
+
+func writePermissionError(w http.ResponseWriter, status int, perr *game.ProtocolError, role auth.Role) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Code: perr.Code, Message: perr.Message, Permission: perr.Permission, Role: string(role)})
+}
+
+// AdminStaffHandler lists the moderators and admins (GET /admin/staff)
+func (s *Server) AdminStaffHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := s.Store.ListStaff()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]StaffResponse, 0, len(users))
+	for _, u := range users {
+		resp = append(resp, StaffResponse{ID: u.ID, Username: u.Username, Role: string(auth.AccountRole(u.Role))})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AdminSetRoleHandler changes an account's role
+// (PUT /admin/users/{username}/role). Admins cannot change their own role,
+// so there is always one left.
+func (s *Server) AdminSetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin := callerFrom(r)
+
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Body must be {role}", http.StatusBadRequest)
+		return
+	}
+	role, ok := auth.ParseRole(req.Role)
+	if !ok {
+		http.Error(w, "Role must be player, moderator or admin", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.Store.GetUserByUsername(names.Clean(r.PathValue("username")))
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.ID == admin.UserID {
+		http.Error(w, "You cannot change your own role", http.StatusConflict)
+		return
+	}
+
+	if err := s.Store.SetUserRole(user.ID, string(role)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, c := range s.clients.All() {
+		if c.user != nil && c.user.UserID == user.ID {
+			c.setRole(role)
+		}
+	}
+	log.Printf("Admin %s made %s a %s", admin.Username, user.Username, role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StaffResponse{ID: user.ID, Username: user.Username, Role: string(role)})
+}
+
+// seedAdmins gives the accounts listed in ADMIN_USER_IDS the admin role, so
+// a new deployment has someone to hand out roles. Accounts are listed by ID
+// rather than username, since anyone could register a listed name that is
+// still free.
+func (s *Server) seedAdmins() {
+	for _, id := range s.Config.AdminUserIDs {
+		user, err := s.Store.GetUser(id)
+		if errors.Is(err, db.ErrNotFound) {
+			log.Printf("ADMIN_USER_IDS lists %s, which has no account", id)
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to look up admin %s: %v", id, err)
+			continue
+		}
+		if auth.AccountRole(user.Role) == auth.RoleAdmin {
+			continue
+		}
+		if err := s.Store.SetUserRole(user.ID, string(auth.RoleAdmin)); err != nil {
+			log.Printf("Failed to make %s an admin: %v", user.Username, err)
+			continue
+		}
+		log.Printf("Made %s (%s) an admin (ADMIN_USER_IDS)", user.Username, user.ID)
+	}
+}
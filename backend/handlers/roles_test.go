@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"4-in-a-row/auth"
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+)
+
+func TestEveryClientMessageHasPermission(t *testing.T) {
+	for _, spec := range game.Messages {
+		if spec.Direction != game.FromClient || spec.Type == game.MsgHello {
+			continue
+		}
+		if _, ok := messagePermissions[spec.Type]; !ok {
+			t.Errorf("%s has no entry in messagePermissions", spec.Type)
+		}
+	}
+}
+
+func TestCheckMessage(t *testing.T) {
+	player := &auth.Claims{UserID: "u1", Username: "alice"}
+
+	tests := []struct {
+		name    string
+		user    *auth.Claims
+		role    auth.Role
+		msgType string
+		want    string // Error code; empty when allowed
+	}{
+		{"guest plays", nil, auth.RoleGuest, game.MsgJoinQueue, ""},
+		{"guest joins lobby", nil, auth.RoleGuest, game.MsgLobbySubscribe, ""},
+		{"guest challenges friend", nil, auth.RoleGuest, game.MsgChallenge, game.ErrCodeLoginRequired},
+		{"player plays", player, auth.RolePlayer, game.MsgMove, ""},
+		{"player challenges friend", player, auth.RolePlayer, game.MsgChallenge, ""},
+		{"admin challenges friend", player, auth.RoleAdmin, game.MsgChallenge, ""},
+		{"account without role", player, "", game.MsgJoinQueue, game.ErrCodePermissionDenied},
+		{"hello", nil, auth.RoleGuest, game.MsgHello, ""},
+		{"unknown", nil, auth.RoleGuest, "NOT_A_MESSAGE", ""}, // Refused later as UNKNOWN_TYPE
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &wsClient{user: tt.user, role: tt.role}
+			err := c.checkMessage(tt.msgType)
+
+			var perr *game.ProtocolError
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("refused: %v", err)
+			case tt.want != "" && (!errors.As(err, &perr) || perr.Code != tt.want):
+				t.Errorf("got %v, want %s", err, tt.want)
+			case perr != nil && perr.Permission != string(messagePermissions[tt.msgType]):
+				t.Errorf("error names permission %q, want %q", perr.Permission, messagePermissions[tt.msgType])
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	s, ts := newTestServer(t, testConfig(), nil)
+	for _, u := range []*db.User{
+		{ID: "player", Username: "alice"},
+		{ID: "moderator", Username: "mod", Role: string(auth.RoleModerator)},
+		{ID: "admin", Username: "root", Role: string(auth.RoleAdmin)},
+	} {
+		if err := s.Store.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		caller string // Account ID, "" for a guest or "bad" for an invalid token
+		path   string
+		want   int
+	}{
+		{"", "/health", http.StatusOK},
+		{"bad", "/health", http.StatusOK},
+
+		{"", "/friends", http.StatusUnauthorized},
+		{"bad", "/friends", http.StatusUnauthorized},
+		{"deleted", "/friends", http.StatusUnauthorized},
+		{"player", "/friends", http.StatusOK},
+		{"moderator", "/friends", http.StatusOK},
+		{"admin", "/friends", http.StatusOK},
+
+		{"", "/admin/games", http.StatusUnauthorized},
+		{"deleted", "/admin/games", http.StatusUnauthorized},
+		{"player", "/admin/games", http.StatusForbidden},
+		{"moderator", "/admin/games", http.StatusOK},
+		{"admin", "/admin/games", http.StatusOK},
+
+		{"player", "/admin/bans", http.StatusForbidden},
+		{"moderator", "/admin/bans", http.StatusOK},
+		{"admin", "/admin/bans", http.StatusOK},
+
+		{"", "/admin/staff", http.StatusUnauthorized},
+		{"player", "/admin/staff", http.StatusForbidden},
+		{"moderator", "/admin/staff", http.StatusForbidden},
+		{"admin", "/admin/staff", http.StatusOK},
+	}
+	for _, tt := range tests {
+		name := tt.caller
+		if name == "" {
+			name = "guest"
+		}
+		t.Run(name+tt.path, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch tt.caller {
+			case "":
+			case "bad":
+				req.Header.Set("Authorization", "Bearer not-a-token")
+			default:
+				token, _, err := s.Sessions.Issue(tt.caller, tt.caller, time.Now())
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("got %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeedAdmins(t *testing.T) {
+	store := db.NewMemoryStore()
+	for _, u := range []*db.User{
+		{ID: "u1", Username: "alice"},
+		{ID: "u2", Username: "bob"},
+		{ID: "u3", Username: "carol", Role: string(auth.RoleModerator)},
+	} {
+		if err := store.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := testConfig()
+	cfg.AdminUserIDs = []string{"u1", "u3", "bob", "missing"}
+	s := NewServer(cfg, store, nil, nil)
+	t.Cleanup(func() { s.Close() })
+
+	want := map[string]auth.Role{
+		"u1": auth.RoleAdmin,
+		"u2": auth.RolePlayer, // Listed by username, which does not count
+		"u3": auth.RoleAdmin,
+	}
+	for id, role := range want {
+		if got, err := s.roleOf(id); err != nil || got != role {
+			t.Errorf("%s is %s (%v), want %s", id, got, err, role)
+		}
+	}
+}
@@ -11,7 +11,7 @@ type RootResponse struct {
 }
 
 // RootHandler returns a simple greeting
-func RootHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) RootHandler(w http.ResponseWriter, r *http.Request) {
 	response := RootResponse{
 		Message: "Hello from Four in a Row Server!",
 	}
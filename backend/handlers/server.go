@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"4-in-a-row/analytics"
+	"4-in-a-row/auth"
+	"4-in-a-row/config"
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+	"4-in-a-row/names"
+	"4-in-a-row/oidc"
+
+	"github.com/rs/cors"
+)
+
+// Server wires the game services together and serves the HTTP and WebSocket API
+type Server struct {
+	Config     *config.Config
+	Store      db.Store
+	Stream     analytics.EventStream
+	Games      *game.GameManager
+	Matchmaker *game.Matchmaker
+	Lobby      *game.Lobby
+	Sessions   *auth.Signer
+	Names      *names.Policy
+	OIDC       *oidc.Provider // Nil unless OIDC login is configured
+
+	oidcFlows *auth.Signer
+
+	limits  *limiter
+	clients *clients
+	bans    *banList
+	stop    chan struct{} // Closed by Close to end background work
+}
+
+// NewServer builds a server around the given dependencies. Each server has
+// its own matchmaking queue and active games.
+func NewServer(cfg *config.Config, store db.Store, stream analytics.EventStream, clock game.Clock) *Server {
+	games := game.NewGameManager(clock, store, stream)
+	games.Tokens = auth.NewSigner(cfg.AuthSecret, game.ReconnectTokenTTL)
+	matchmaker := game.NewMatchmaker(games)
+	s := &Server{
+		Config:     cfg,
+		Store:      games.Store,
+		Stream:     games.Stream,
+		Games:      games,
+		Matchmaker: matchmaker,
+		Lobby:      game.NewLobby(matchmaker),
+		Sessions:   auth.NewSigner(cfg.AuthSecret, cfg.SessionTTL),
+		Names:      names.NewPolicy(cfg.UsernameBlocklist, cfg.UsernameAllowlist),
+		limits:     newLimiter(cfg),
+		clients:    newClients(),
+		bans:       newBanList(games.Store),
+		stop:       make(chan struct{}),
+		oidcFlows:  auth.NewSigner(cfg.AuthSecret, oidcFlowTTL),
+	}
+
+	if cfg.OIDCIssuer != "" {
+		s.OIDC = oidc.New(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+		}, nil)
+	}
+
+	s.seedAdmins()
+	if err := s.bans.Load(time.Now()); err != nil {
+		log.Printf("Failed to load bans: %v", err)
+	}
+	if cfg.BanRefreshInterval > 0 {
+		go s.bans.Refresh(cfg.BanRefreshInterval, s.stop)
+	}
+	return s
+}
+
+// now reads the game clock, so connection state and reconnect tokens are
+// judged by the same time the games issue them with. Socket deadlines and
+// heartbeats stay on the wall clock.
+func (s *Server) now() time.Time {
+	return s.Games.Clock.Now()
+}
+
+// Routes returns the server's HTTP handler with CORS applied
+func (s *Server) Routes() http.Handler {
+	mux := http.NewServeMux()
+
+	// Public
+	s.handle(mux, "/", "", s.RootHandler)
+	s.handle(mux, "/health", "", s.HealthHandler)
+	s.handle(mux, "POST /auth/register", "", s.RegisterHandler)
+	s.handle(mux, "POST /auth/login", "", s.LoginHandler)
+	s.handle(mux, "GET /auth/oidc/login", "", s.OIDCLoginHandler)
+	s.handle(mux, "GET /auth/oidc/callback", "", s.OIDCCallbackHandler)
+	s.handle(mux, "/ws", "", s.WSHandler) // Checks each message against messagePermissions
+	s.handle(mux, "/leaderboard", "", s.LeaderboardHandler)
+	s.handle(mux, "/metrics", "", s.GameMetricsHandler)
+	s.handle(mux, "/recent-games", "", s.RecentGamesHandler)
+	s.handle(mux, "/game-history", "", s.GameHistoryHandler)
+	s.handle(mux, "GET /games/{id}/events", "", s.GameEventsHandler)
+	s.handle(mux, "GET /players/{username}", "", s.PlayerProfileHandler)
+	s.handle(mux, "GET /players/{a}/vs/{b}", "", s.HeadToHeadHandler)
+
+	// Account
+	s.handle(mux, "POST /auth/oidc/link", auth.PermAccount, s.OIDCLinkHandler)
+	s.handle(mux, "GET /friends", auth.PermAccount, s.FriendsHandler)
+	s.handle(mux, "POST /friends", auth.PermAccount, s.AddFriendHandler)
+	s.handle(mux, "POST /friends/{userId}/accept", auth.PermAccount, s.AcceptFriendHandler)
+	s.handle(mux, "DELETE /friends/{userId}", auth.PermAccount, s.RemoveFriendHandler)
+	s.handle(mux, "GET /blocks", auth.PermAccount, s.BlocksHandler)
+	s.handle(mux, "POST /blocks", auth.PermAccount, s.BlockHandler)
+	s.handle(mux, "DELETE /blocks/{userId}", auth.PermAccount, s.UnblockHandler)
+	s.handle(mux, "POST /reports", auth.PermAccount, s.ReportHandler)
+
+	// Moderators
+	s.handle(mux, "GET /admin/games", auth.PermViewLive, s.AdminGamesHandler)
+	s.handle(mux, "GET /admin/games/{id}", auth.PermViewLive, s.AdminGameHandler)
+	s.handle(mux, "GET /admin/queue", auth.PermViewLive, s.AdminQueueHandler)
+	s.handle(mux, "GET /admin/connections", auth.PermViewLive, s.AdminConnectionsHandler)
+	s.handle(mux, "DELETE /admin/connections/{id}", auth.PermModerate, s.AdminKickHandler)
+	s.handle(mux, "GET /admin/bans", auth.PermModerate, s.AdminBansHandler)
+	s.handle(mux, "POST /admin/bans", auth.PermModerate, s.AdminBanHandler)
+	s.handle(mux, "DELETE /admin/bans/{id}", auth.PermModerate, s.AdminUnbanHandler)
+	s.handle(mux, "GET /admin/reports", auth.PermModerate, s.AdminReportsHandler)
+	s.handle(mux, "GET /admin/reports/{id}", auth.PermModerate, s.AdminReportHandler)
+	s.handle(mux, "POST /admin/reports/{id}/resolve", auth.PermModerate, s.AdminResolveReportHandler)
+
+	// Admins
+	s.handle(mux, "POST /admin/games/{id}/abort", auth.PermOperate, s.AdminAbortGameHandler)
+	s.handle(mux, "POST /admin/notices", auth.PermOperate, s.AdminNoticeHandler)
+	s.handle(mux, "GET /admin/staff", auth.PermManageRoles, s.AdminStaffHandler)
+	s.handle(mux, "PUT /admin/users/{username}/role", auth.PermManageRoles, s.AdminSetRoleHandler)
+
+	// CORS
+	c := cors.New(cors.Options{
+		AllowedOrigins: []string{
+			"http://localhost:3000",
+			"https://four-in-a-row.myselfankit.tech",
+		},
+		AllowedMethods: []string{
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
+		AllowedHeaders: []string{
+			"Content-Type",
+			"Authorization",
+		},
+		// Only for the OIDC flow cookie that POST /auth/oidc/link sets, which
+		// ties a link to the browser that started it. Sessions are bearer
+		// tokens, never cookies, so credentialed requests from the origins
+		// above carry no ambient authority.
+		AllowCredentials: true,
+	})
+
+	return c.Handler(mux)
+}
+
+// Close stops the ban refresh and releases the server's event stream
+func (s *Server) Close() error {
+	close(s.stop)
+	return s.Stream.Close()
+}
@@ -1,9 +1,17 @@
 package handlers
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
+	"4-in-a-row/auth"
+	"4-in-a-row/db"
 	"4-in-a-row/game"
 
 	"github.com/google/uuid"
@@ -13,10 +21,75 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    game.Subprotocols,
 	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
-func WSHandler(w http.ResponseWriter, r *http.Request) {
+// Heartbeat timing: a peer that misses pongWait worth of pongs is treated as gone
+const (
+	pingPeriod = 5 * time.Second
+	pongWait   = 12 * time.Second
+	writeWait  = 5 * time.Second
+)
+
+// wsClient is the per-connection state of a WebSocket client. Only the
+// connection's read loop changes it; other goroutines go through notify and
+// info, which take mu.
+type wsClient struct {
+	id          string
+	ip          string
+	connectedAt time.Time
+
+	server  *Server
+	conn    *websocket.Conn
+	mu      sync.Mutex // Guards player, client and role for other goroutines, serialises writes made without a player, and is held while a player is attached
+	player  *game.Player
+	client  game.ClientInfo // Protocol spoken on this connection; legacy until the client says HELLO
+	user    *auth.Claims    // Account from the session token; nil for guests
+	role    auth.Role       // Follows role changes made while connected
+	greeted bool
+	replies game.ReplyCache // Replies to requests made before the connection had a player
+
+	rate    *tokenBucket // Messages on this connection
+	ipRate  *tokenBucket // Messages from all of this IP's connections
+	strikes int          // Messages dropped for exceeding the rate
+
+	closeCode   int // Set when the connection must be closed after the current reply
+	closeReason string
+}
+
+func (s *Server) WSHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := s.sessionFromRequest(r)
+	if err != nil {
+		http.Error(w, "Invalid session token", http.StatusUnauthorized)
+		return
+	}
+	if user == nil && !s.Config.AllowGuests {
+		http.Error(w, "Login required", http.StatusUnauthorized)
+		return
+	}
+
+	ip := clientIP(r, s.Config.TrustProxyHeaders, s.Config.TrustedProxyHops)
+	var userID, username string
+	role := auth.RoleGuest
+	if user != nil {
+		userID, username = user.UserID, user.Username
+		if role, err = s.roleOf(user.UserID); err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				http.Error(w, "Account no longer exists", http.StatusUnauthorized)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	if ban, banned := s.bans.Match(userID, username, ip, s.now()); banned {
+		s.bans.blockedConns.Add(1)
+		log.Printf("Refused connection from %s (%s): ban %d", ip, username, ban.ID)
+		writeError(w, http.StatusForbidden, bannedError(ban))
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Failed to upgrade WS:", err)
@@ -24,27 +97,57 @@ func WSHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	log.Println("New Client Connected")
+	codec := game.CodecFor(conn.Subprotocol())
+	client := game.LegacyClient(codec)
 
-	var currentPlayer *game.Player
+	ipRate, ok := s.limits.Open(ip, s.now())
+	if !ok {
+		log.Printf("Rejected connection from %s: too many connections", ip)
+		client.WriteMessage(conn, game.ErrorMessage(&game.ProtocolError{Code: game.ErrCodeTooManyConnections, Message: "Too many connections from your address"}, nil))
+		closeConn(conn, websocket.ClosePolicyViolation, "too many connections")
+		return
+	}
+	defer s.limits.Close(ip)
 
-	defer func() {
-		if currentPlayer != nil {
-			removed := game.GlobalMatchmaker.RemovePlayer(currentPlayer)
-			if removed {
-				log.Printf("Player %s removed from matchmaking queue on disconnect", currentPlayer.Username)
-			}
+	log.Printf("New Client Connected (encoding: %s)", codec.Name())
 
-			g := game.GameManagerInstance.GetGameByPlayerID(currentPlayer.ID)
-			if g != nil {
-				g.HandleDisconnect(currentPlayer)
-			}
-		}
-	}()
+	c := &wsClient{
+		id:          uuid.New().String(),
+		ip:          ip,
+		connectedAt: s.now(),
+		server:      s,
+		conn:        conn,
+		client:      client,
+		user:        user,
+		role:        role,
+		rate:        newTokenBucket(s.Config.WSMessageRate, s.Config.WSMessageBurst, s.now()),
+		ipRate:      ipRate,
+	}
+	s.clients.Add(c)
+	defer s.clients.Remove(c)
+
+	// Heartbeat: ping with the send time and measure the round trip on pong
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(c.handlePong)
+
+	stopPing := make(chan struct{})
+	defer close(stopPing)
+	go pingLoop(conn, stopPing)
+
+	defer c.cleanup()
 
 	for {
-		var msg game.Message
-		err := conn.ReadJSON(&msg)
+		data, err := c.readMessage()
+		if errors.Is(err, errMessageTooLarge) {
+			s.limits.oversized.Add(1)
+			log.Printf("Closed connection from %s: message over %d bytes", ip, s.Config.WSMaxMessageBytes)
+			c.fail(&game.ProtocolError{
+				Code:    game.ErrCodeMessageTooLarge,
+				Message: fmt.Sprintf("Messages are limited to %d bytes", s.Config.WSMaxMessageBytes),
+			}, nil)
+			closeConn(conn, websocket.ClosePolicyViolation, "message too large")
+			return
+		}
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WS Read Error: %v", err)
@@ -52,99 +155,678 @@ func WSHandler(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
-		switch msg.Type {
-		case game.MsgJoinQueue:
-			username, ok := msg.Payload.(string)
-			if !ok {
-				username = "Anonymous"
-			}
+		msg, err := codec.Decode(data)
+		switch {
+		case !c.allow():
+			c.rateLimited(&msg)
+		case err != nil:
+			c.fail(err, nil)
+		default:
+			c.dispatch(&msg)
+		}
 
-			// Check if username is already in matchmaking queue
-			if game.GlobalMatchmaker.IsPlayerInQueue(username) {
-				conn.WriteJSON(game.Message{Type: game.MsgError, Payload: "Username already in matchmaking queue"})
-				continue
-			}
+		if c.closeCode != 0 {
+			closeConn(conn, c.closeCode, c.closeReason)
+			return
+		}
+	}
+}
 
-			// Check if current player is already in an active game
-			if currentPlayer != nil {
-				playerGame := game.GameManagerInstance.GetGameByPlayerID(currentPlayer.ID)
-				if playerGame != nil && playerGame.State == "active" {
-					conn.WriteJSON(game.Message{Type: game.MsgError, Payload: "You are already in an active game"})
-					continue
-				}
-			}
+// errMessageTooLarge is returned by readMessage for messages over the limit
+var errMessageTooLarge = errors.New("message too large")
 
-			// Check if username exists in an active game
-			existingPlayer, existingGame := game.GameManagerInstance.GetPlayerByUsername(username)
-			if existingPlayer != nil && existingGame != nil {
-				if !existingPlayer.IsConnected {
-					// Player disconnected, allow reconnection
-					log.Printf("User %s reconnecting to game %s", username, existingGame.ID)
-					reconnectedPlayer, success := existingGame.HandleReconnect(existingPlayer.ID, conn)
-					if success {
-						currentPlayer = reconnectedPlayer
-					} else {
-						conn.WriteJSON(game.Message{Type: game.MsgError, Payload: "Reconnect failed"})
-					}
-					continue
-				} else {
-					// Player is connected in another session
-					conn.WriteJSON(game.Message{Type: game.MsgError, Payload: "Username already in use"})
-					continue
-				}
-			}
+// readMessage reads the next message, refusing one over WSMaxMessageBytes.
+// The limit is enforced here rather than with SetReadLimit, which closes
+// the connection with 1009 before the client can be told why; reading
+// stops one byte past the limit, so the rest of the frame is never buffered.
+func (c *wsClient) readMessage() ([]byte, error) {
+	_, r, err := c.conn.NextReader()
+	if err != nil {
+		return nil, err
+	}
 
-			player := &game.Player{
-				ID:       uuid.New().String(),
-				Username: username,
-				Conn:     conn,
-			}
+	limit := c.server.Config.WSMaxMessageBytes
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errMessageTooLarge
+	}
+	return data, nil
+}
 
-			currentPlayer = player
-			game.GlobalMatchmaker.AddPlayer(player)
+// dispatch handles one client message. Requests carrying an ID are answered
+// with ACK or NACK, and a resent ID gets the original reply again without
+// being handled twice.
+func (c *wsClient) dispatch(msg *game.ClientMessage) {
+	if msg.ID != "" {
+		if reply, ok := c.cachedReply(msg.ID); ok {
+			c.send(reply)
+			return
+		}
+	}
 
-		case game.MsgReconnect:
-			playerID, ok := msg.Payload.(string)
-			if !ok {
-				continue
-			}
+	err := c.handle(msg)
 
-			g := game.GameManagerInstance.GetGameByPlayerID(playerID)
-			if g != nil {
-				p, success := g.HandleReconnect(playerID, conn)
-				if success {
-					currentPlayer = p
-				} else {
-					conn.WriteJSON(game.Message{Type: game.MsgError, Payload: "Reconnect failed or game ended"})
-				}
-			} else {
-				conn.WriteJSON(game.Message{Type: game.MsgError, Payload: "Game not found"})
-			}
+	if msg.ID != "" {
+		reply := game.ReplyMessage(msg, err)
+		c.rememberReply(msg.ID, reply)
+		c.send(reply)
+	} else if err != nil {
+		c.fail(err, msg)
+	}
+}
 
-		case game.MsgMove:
-			payload, ok := msg.Payload.(map[string]interface{})
-			if !ok {
-				continue
-			}
+func (c *wsClient) handle(msg *game.ClientMessage) error {
+	if msg.Type != game.MsgHello && !c.greeted && !game.LegacyAllowed(c.server.now(), c.server.Config.LegacyProtocolSunset) {
+		c.closeAfter(websocket.CloseProtocolError, "handshake required")
+		return &game.ProtocolError{Code: game.ErrCodeHandshakeRequired, Message: "HELLO handshake required before any other message"}
+	}
+
+	if err := c.checkMessage(msg.Type); err != nil {
+		return err
+	}
+
+	var err error
+
+	switch msg.Type {
+	case game.MsgHello:
+		err = c.handleHello(msg)
+	case game.MsgJoinQueue:
+		err = c.handleJoinQueue(msg)
+	case game.MsgLeaveQueue:
+		err = c.handleLeaveQueue()
+	case game.MsgReconnect:
+		err = c.handleReconnect(msg)
+	case game.MsgMove:
+		err = c.handleMove(msg)
+	case game.MsgSync:
+		err = c.handleSync(msg)
+	case game.MsgLobbySubscribe:
+		err = c.handleLobbySubscribe(msg)
+	case game.MsgLobbyUnsubscribe:
+		err = c.handleLobbyUnsubscribe()
+	case game.MsgChallengePost:
+		err = c.handleChallengePost(msg)
+	case game.MsgChallenge:
+		err = c.handleDirectChallenge(msg)
+	case game.MsgChallengeCancel, game.MsgChallengeAccept, game.MsgChallengeDecline:
+		err = c.handleChallengeRef(msg)
+	default:
+		err = &game.ProtocolError{Code: game.ErrCodeUnknownType, Message: "Unknown message type " + msg.Type}
+	}
+	return err
+}
+
+func (c *wsClient) handleHello(msg *game.ClientMessage) error {
+	if c.greeted || c.player != nil {
+		return &game.ProtocolError{Code: game.ErrCodeBadMessage, Message: "HELLO must be the first message and sent only once"}
+	}
+
+	hello, err := game.DecodeHello(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	info, welcome, err := game.Negotiate(hello, c.client.Codec, c.server.now(), c.server.Config.LegacyProtocolSunset)
+	if err != nil {
+		log.Printf("Rejected client speaking protocol version %d: %v", hello.Version, err)
+		c.closeAfter(websocket.CloseProtocolError, "unsupported protocol version")
+		return &game.ProtocolError{Code: game.ErrCodeUnsupportedVersion, Message: err.Error()}
+	}
+
+	c.mu.Lock()
+	c.client = info
+	c.mu.Unlock()
+	c.greeted = true
+	c.send(game.Message{Type: game.MsgWelcome, Payload: welcome})
+	return nil
+}
+
+func (c *wsClient) handleJoinQueue(msg *game.ClientMessage) error {
+	s := c.server
+
+	join, err := game.DecodeJoinQueue(msg.Payload)
+	if err != nil {
+		return err
+	}
+	username := join.Username
+
+	// Lobby members queue under the name they subscribed with
+	member := c.player != nil && s.Lobby.IsMember(c.player)
+	userID := ""
+	if member {
+		username, userID = c.player.Username, c.player.UserID
+		if err := c.checkBan(userID, username); err != nil {
+			return err
+		}
+	} else {
+		if username, userID, err = c.identity(username); err != nil {
+			return err
+		}
+		if s.Lobby.IsUsernameTaken(username) {
+			return &game.ProtocolError{Code: game.ErrCodeUsernameTaken, Message: "Username already in use"}
+		}
+	}
+
+	// Check if username is already in matchmaking queue
+	if s.Matchmaker.IsPlayerInQueue(username) {
+		return &game.ProtocolError{Code: game.ErrCodeAlreadyInQueue, Message: "Username already in matchmaking queue"}
+	}
+
+	// Check if current player is already in an active game
+	if c.player != nil {
+		playerGame := s.Games.GetGameByPlayerID(c.player.ID)
+		if playerGame != nil && playerGame.State == "active" {
+			return &game.ProtocolError{Code: game.ErrCodeAlreadyInGame, Message: "You are already in an active game"}
+		}
+	}
+
+	// Check if username exists in an active game
+	existingPlayer, existingGame := s.Games.GetPlayerByUsername(username)
+	if existingPlayer != nil && existingGame != nil {
+		// Guests reclaim their seat with RECONNECT and its token; a logged-in
+		// account may also return to its own seat from a new client
+		if existingPlayer.IsConnected || userID == "" || existingPlayer.UserID != userID {
+			return &game.ProtocolError{Code: game.ErrCodeUsernameTaken, Message: "Username already in use"}
+		}
+
+		// Player disconnected, allow reconnection
+		log.Printf("User %s reconnecting to game %s", username, existingGame.ID)
+		if _, success := c.reconnect(existingGame, existingPlayer.ID, 0); !success {
+			return &game.ProtocolError{Code: game.ErrCodeReconnectFailed, Message: "Reconnect failed"}
+		}
+		return nil
+	}
+
+	if member {
+		s.Lobby.SetStatus(c.player, game.StatusQueued)
+		s.Matchmaker.AddPlayer(c.player)
+		return nil
+	}
+
+	player := &game.Player{
+		ID:       uuid.New().String(),
+		UserID:   userID,
+		Username: username,
+	}
+	c.attach(player)
+	s.Matchmaker.AddPlayer(player)
+	return nil
+}
+
+func (c *wsClient) handleLeaveQueue() error {
+	if c.player == nil || !c.server.Matchmaker.RemovePlayer(c.player) {
+		return &game.ProtocolError{Code: game.ErrCodeNotInQueue, Message: "You are not in the matchmaking queue"}
+	}
+	c.server.Lobby.SetStatus(c.player, game.StatusIdle)
+	c.send(game.Message{Type: game.MsgQueueStatus, Payload: game.QueueStatusPayload{InQueue: false}})
+	return nil
+}
+
+func (c *wsClient) handleReconnect(msg *game.ClientMessage) error {
+	req, err := game.DecodeReconnect(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	seat, err := c.server.Games.Tokens.VerifyReconnect(req.Token, c.server.now())
+	if err != nil {
+		return &game.ProtocolError{Code: game.ErrCodeReconnectFailed, Message: "Reconnect token is invalid or expired"}
+	}
+
+	g := c.server.Games.GetGame(seat.GameID)
+	if g == nil {
+		return &game.ProtocolError{Code: game.ErrCodeGameNotFound, Message: "Game not found"}
+	}
+
+	var p *game.Player
+	switch seat.PlayerID {
+	case g.Player1.ID:
+		p = g.Player1
+	case g.Player2.ID:
+		p = g.Player2
+	}
+	if p != nil {
+		if err := c.checkBan(p.UserID, p.Username); err != nil {
+			return err
+		}
+	}
+
+	if _, success := c.reconnect(g, seat.PlayerID, req.LastSeq); !success {
+		return &game.ProtocolError{Code: game.ErrCodeReconnectFailed, Message: "Reconnect failed or game ended"}
+	}
+	return nil
+}
+
+func (c *wsClient) handleMove(msg *game.ClientMessage) error {
+	move, err := game.DecodeMove(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	g := c.server.Games.GetGame(move.GameID)
+	if g == nil {
+		return &game.ProtocolError{Code: game.ErrCodeGameNotFound, Message: "Game not found"}
+	}
+
+	p, err := c.playerIn(g)
+	if err != nil {
+		return err
+	}
+
+	return g.HandleMove(p, *move.Column)
+}
+
+func (c *wsClient) handleSync(msg *game.ClientMessage) error {
+	req, err := game.DecodeSync(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	g := c.server.Games.GetGame(req.GameID)
+	if g == nil {
+		return &game.ProtocolError{Code: game.ErrCodeGameNotFound, Message: "Game not found"}
+	}
+
+	p, err := c.playerIn(g)
+	if err != nil {
+		return err
+	}
 
-			gameID, _ := payload["gameId"].(string)
-			col, _ := payload["column"].(float64)
-
-			g := game.GameManagerInstance.GetGame(gameID)
-			if g != nil {
-				var p *game.Player
-				if currentPlayer != nil {
-					p = currentPlayer
-				} else if g.Player1.Conn == conn {
-					p = g.Player1
-				} else if g.Player2.Conn == conn {
-					p = g.Player2
-				}
-
-				if p != nil {
-					g.HandleMove(p, int(col))
-				}
+	g.Sync(p)
+	return nil
+}
+
+func (c *wsClient) handleLobbySubscribe(msg *game.ClientMessage) error {
+	s := c.server
+
+	sub, err := game.DecodeLobbySubscribe(msg.Payload)
+	if err != nil {
+		return err
+	}
+
+	if c.player == nil {
+		if sub.Username == "" && c.user == nil {
+			return &game.ProtocolError{Code: game.ErrCodeBadMessage, Message: "LOBBY_SUBSCRIBE requires a username"}
+		}
+		username, userID, err := c.identity(sub.Username)
+		if err != nil {
+			return err
+		}
+		existingPlayer, _ := s.Games.GetPlayerByUsername(username)
+		if existingPlayer != nil || s.Lobby.IsUsernameTaken(username) || s.Matchmaker.IsPlayerInQueue(username) {
+			return &game.ProtocolError{Code: game.ErrCodeUsernameTaken, Message: "Username already in use"}
+		}
+
+		player := &game.Player{
+			ID:       uuid.New().String(),
+			UserID:   userID,
+			Username: username,
+		}
+		c.attach(player)
+	}
+
+	status := game.StatusIdle
+	if _, queued := s.Matchmaker.QueueStatus(c.player); queued {
+		status = game.StatusQueued
+	} else if g := s.Games.GetGameByPlayerID(c.player.ID); g != nil && g.State == "active" {
+		status = game.StatusPlaying
+	}
+
+	s.Lobby.Join(c.player, status)
+	return nil
+}
+
+func (c *wsClient) handleLobbyUnsubscribe() error {
+	if c.player == nil || !c.server.Lobby.Leave(c.player) {
+		return &game.ProtocolError{Code: game.ErrCodeNotInLobby, Message: "You are not in the lobby"}
+	}
+	return nil
+}
+
+func (c *wsClient) handleChallengePost(msg *game.ClientMessage) error {
+	req, err := game.DecodeChallenge(msg.Payload)
+	if err != nil {
+		return err
+	}
+	if c.player == nil {
+		return &game.ProtocolError{Code: game.ErrCodeNotInLobby, Message: "Subscribe to the lobby first"}
+	}
+	if err := c.checkBan(c.player.UserID, c.player.Username); err != nil {
+		return err
+	}
+
+	_, err = c.server.Lobby.PostChallenge(c.player, req)
+	return err
+}
+
+func (c *wsClient) handleChallengeRef(msg *game.ClientMessage) error {
+	ref, err := game.DecodeChallengeRef(msg.Payload)
+	if err != nil {
+		return err
+	}
+	if c.player == nil {
+		return &game.ProtocolError{Code: game.ErrCodeNotInLobby, Message: "Subscribe to the lobby first"}
+	}
+
+	switch msg.Type {
+	case game.MsgChallengeCancel:
+		return c.server.Lobby.CancelChallenge(c.player, ref.ChallengeID)
+	case game.MsgChallengeDecline:
+		return c.server.Lobby.DeclineChallenge(c.player, ref.ChallengeID)
+	}
+
+	if err := c.checkBan(c.player.UserID, c.player.Username); err != nil {
+		return err
+	}
+	return c.server.Lobby.AcceptChallenge(c.player, ref.ChallengeID)
+}
+
+func (c *wsClient) handleDirectChallenge(msg *game.ClientMessage) error {
+	req, err := game.DecodeDirectChallenge(msg.Payload)
+	if err != nil {
+		return err
+	}
+	if c.user == nil {
+		return &game.ProtocolError{Code: game.ErrCodeLoginRequired, Message: "Log in to challenge friends"}
+	}
+	if c.player == nil {
+		return &game.ProtocolError{Code: game.ErrCodeNotInLobby, Message: "Subscribe to the lobby first"}
+	}
+
+	friends, err := c.server.areFriends(c.user.UserID, req.UserID)
+	if err != nil {
+		log.Printf("Failed to look up friendship of %s and %s: %v", c.user.UserID, req.UserID, err)
+		return &game.ProtocolError{Code: game.ErrCodeInternal, Message: "Could not check friendship, please try again"}
+	}
+	if !friends {
+		return &game.ProtocolError{Code: game.ErrCodeNotFriends, Message: "You can only challenge your friends"}
+	}
+	if err := c.checkBan(c.player.UserID, c.player.Username); err != nil {
+		return err
+	}
+
+	_, err = c.server.Lobby.ChallengeFriend(c.player, req)
+	return err
+}
+
+// identity returns the name and account a new player on this connection
+// gets. Logged-in clients always play as their account; guests may use any
+// name the username policy allows that is not registered or confusable with
+// a registered one. Banned accounts, names and addresses are refused.
+func (c *wsClient) identity(requested string) (username, userID string, err error) {
+	if c.user != nil {
+		if err := c.checkBan(c.user.UserID, c.user.Username); err != nil {
+			return "", "", err
+		}
+		return c.user.Username, c.user.UserID, nil
+	}
+
+	if username, err = c.server.checkUsername(requested); err != nil {
+		return "", "", err
+	}
+
+	_, err = c.server.Store.FindConfusableUser(username)
+	switch {
+	case err == nil:
+		return "", "", &game.ProtocolError{Code: game.ErrCodeUsernameTaken, Message: "That username is registered; log in to use it"}
+	case !errors.Is(err, db.ErrNotFound):
+		log.Printf("Failed to look up user %s: %v", username, err)
+		return "", "", &game.ProtocolError{Code: game.ErrCodeInternal, Message: "Could not check username, please try again"}
+	}
+	if err := c.checkBan("", username); err != nil {
+		return "", "", err
+	}
+	return username, "", nil
+}
+
+// checkBan refuses to let a banned account, username or address play. It
+// runs whenever a connection takes on a player identity and again before a
+// challenge that can start a game, since bans can be added at any time.
+func (c *wsClient) checkBan(userID, username string) error {
+	ban, banned := c.server.bans.Match(userID, username, c.ip, c.server.now())
+	if !banned {
+		return nil
+	}
+	c.server.bans.blockedJoins.Add(1)
+	log.Printf("Refused play from %s (%s): ban %d", c.ip, username, ban.ID)
+	return bannedError(ban)
+}
+
+// playerIn returns this connection's player in g
+func (c *wsClient) playerIn(g *game.Game) (*game.Player, error) {
+	var p *game.Player
+	if c.player != nil {
+		p = c.player
+	} else if g.Player1.AttachedTo(c.conn) {
+		p = g.Player1
+	} else if g.Player2.AttachedTo(c.conn) {
+		p = g.Player2
+	}
+	if p == nil || (p != g.Player1 && p != g.Player2) {
+		return nil, &game.ProtocolError{Code: game.ErrCodeNotInGame, Message: "You are not playing in this game"}
+	}
+	return p, nil
+}
+
+// handlePong extends the read deadline and records the heartbeat round trip
+func (c *wsClient) handlePong(appData string) error {
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	if len(appData) != 8 {
+		return nil
+	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64([]byte(appData))))
+	if p := c.player; p != nil {
+		if g := c.server.Games.GetGameByPlayerID(p.ID); g != nil {
+			g.UpdateLatency(p, time.Since(sent))
+		}
+	}
+	return nil
+}
+
+// cleanup removes the player from matchmaking and starts the disconnect
+// countdown once the connection is gone
+func (c *wsClient) cleanup() {
+	if c.player == nil {
+		return
+	}
+	s := c.server
+
+	removed := s.Matchmaker.RemovePlayer(c.player)
+	if removed {
+		log.Printf("Player %s removed from matchmaking queue on disconnect", c.player.Username)
+	}
+
+	if c.player.AttachedTo(c.conn) {
+		s.Lobby.Leave(c.player)
+	}
+
+	// Skip if the session already resumed on a newer connection
+	g := s.Games.GetGameByPlayerID(c.player.ID)
+	if g != nil && c.player.AttachedTo(c.conn) {
+		g.HandleDisconnect(c.player)
+	}
+}
+
+// send routes replies through the player's session once there is one so
+// they are sequenced and never written concurrently with game messages
+func (c *wsClient) send(msg game.Message) {
+	if c.player != nil && c.player.AttachedTo(c.conn) {
+		c.player.SendMessage(msg)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client.WriteMessage(c.conn, msg)
+}
+
+// notify is send for goroutines other than the connection's read loop
+func (c *wsClient) notify(msg game.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.player != nil && c.player.AttachedTo(c.conn) {
+		c.player.SendMessage(msg)
+		return
+	}
+	c.client.WriteMessage(c.conn, msg)
+}
+
+// attach makes p the connection's player and writes p's session messages to
+// the connection. Both happen under mu: until c.player is set, notify writes
+// to the connection itself, which must not overlap p's own writes.
+func (c *wsClient) attach(p *game.Player) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p.Attach(c.conn, c.client)
+	c.player = p
+}
+
+// reconnect moves playerID's seat in g to the connection and makes it the
+// connection's player, under mu for the same reason as attach
+func (c *wsClient) reconnect(g *game.Game, playerID string, lastSeq int64) (*game.Player, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := g.HandleReconnect(playerID, c.conn, c.client, lastSeq)
+	if ok {
+		c.player = p
+	}
+	return p, ok
+}
+
+func (c *wsClient) setRole(role auth.Role) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.role = role
+}
+
+func (c *wsClient) currentRole() auth.Role {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.role
+}
+
+// info describes the connection for the admin API
+func (c *wsClient) info() ConnectionInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info := ConnectionInfo{
+		ID:              c.id,
+		IP:              c.ip,
+		Role:            string(c.role),
+		ProtocolVersion: c.client.Version,
+		Encoding:        c.client.Codec.Name(),
+		ConnectedAt:     c.connectedAt,
+	}
+	if c.user != nil {
+		info.UserID = c.user.UserID
+		info.Username = c.user.Username
+	}
+	if c.player != nil {
+		info.PlayerID = c.player.ID
+		info.Username = c.player.Username
+		if g := c.server.Games.GetGameByPlayerID(c.player.ID); g != nil {
+			info.GameID = g.ID
+		}
+	}
+	return info
+}
+
+// kick closes the connection from another goroutine; the read loop then
+// cleans up as if the client had disconnected
+func (c *wsClient) kick(reason string) {
+	closeConn(c.conn, websocket.ClosePolicyViolation, reason)
+	c.conn.Close()
+}
+
+// fail reports err to the client as an ERROR caused by req
+func (c *wsClient) fail(err error, req *game.ClientMessage) {
+	perr := game.AsProtocolError(err)
+	c.send(game.ErrorMessage(perr, req))
+}
+
+// cachedReply looks up the reply already sent for a request ID, in the
+// player's session first so resends after a reconnect are recognised
+func (c *wsClient) cachedReply(id string) (game.Message, bool) {
+	if c.player != nil {
+		if reply, ok := c.player.Replies().Get(id); ok {
+			return reply, true
+		}
+	}
+	return c.replies.Get(id)
+}
+
+func (c *wsClient) rememberReply(id string, reply game.Message) {
+	if c.player != nil {
+		c.player.Replies().Put(id, reply)
+		return
+	}
+	c.replies.Put(id, reply)
+}
+
+// allow takes a token from both the connection's and the IP's bucket
+func (c *wsClient) allow() bool {
+	now := c.server.now()
+	return c.rate.Allow(now) && c.ipRate.Allow(now)
+}
+
+// rateLimited drops msg with an error, closing the connection once it has
+// gone over the rate rateLimitStrikes times. The reply is not cached so the
+// request can be resent once the client slows down.
+func (c *wsClient) rateLimited(msg *game.ClientMessage) {
+	limits := c.server.limits
+	limits.rateLimited.Add(1)
+
+	err := &game.ProtocolError{Code: game.ErrCodeRateLimited, Message: "Too many messages; slow down"}
+	switch {
+	case msg.ID != "":
+		c.send(game.ReplyMessage(msg, err))
+	case msg.Type != "":
+		c.fail(err, msg)
+	default: // Undecodable
+		c.fail(err, nil)
+	}
+
+	c.strikes++
+	if c.strikes >= rateLimitStrikes {
+		limits.closed.Add(1)
+		c.closeAfter(websocket.ClosePolicyViolation, "rate limit exceeded")
+	}
+}
+
+// closeAfter makes the read loop close the connection once the current
+// request has been answered
+func (c *wsClient) closeAfter(code int, reason string) {
+	c.closeCode = code
+	c.closeReason = reason
+}
+
+// pingLoop sends heartbeat pings until stop is closed or a write fails
+func pingLoop(conn *websocket.Conn, stop <-chan struct{}) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			payload := make([]byte, 8)
+			binary.BigEndian.PutUint64(payload, uint64(time.Now().UnixNano()))
+			if err := conn.WriteControl(websocket.PingMessage, payload, time.Now().Add(writeWait)); err != nil {
+				return
 			}
 		}
 	}
 }
+
+// closeConn sends a close frame with the given code; the read loop then ends
+func closeConn(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+}
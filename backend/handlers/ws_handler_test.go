@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"4-in-a-row/config"
+	"4-in-a-row/db"
+	"4-in-a-row/game"
+
+	"github.com/gorilla/websocket"
+)
+
+// testConfig is a configuration with guests allowed and no inbound limits
+func testConfig() *config.Config {
+	return &config.Config{AuthSecret: []byte("secret"), SessionTTL: time.Hour, AllowGuests: true}
+}
+
+// newTestServer serves a Server on an in-memory store; clock may be nil
+func newTestServer(t *testing.T, cfg *config.Config, clock game.Clock) (*Server, *httptest.Server) {
+	t.Helper()
+	s := NewServer(cfg, db.NewMemoryStore(), nil, clock)
+	ts := httptest.NewServer(s.Routes())
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return s, ts
+}
+
+// wireMessage is a server message with its payload left encoded
+type wireMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	Seq     int64           `json:"seq"`
+}
+
+// dialWS opens a WebSocket to ts, logged in when token is set
+func dialWS(t *testing.T, ts *httptest.Server, token string) *websocket.Conn {
+	t.Helper()
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// request sends a client message with an ID
+func request(t *testing.T, conn *websocket.Conn, id, msgType string, payload interface{}) {
+	t.Helper()
+	msg := map[string]interface{}{"id": id, "type": msgType}
+	if payload != nil {
+		msg["payload"] = payload
+	}
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readType reads messages until one of type msgType arrives
+func readType(t *testing.T, conn *websocket.Conn, msgType string) wireMessage {
+	t.Helper()
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var msg wireMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for %s: %v", msgType, err)
+		}
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+// reply reads until the ACK or NACK of request id arrives
+func reply(t *testing.T, conn *websocket.Conn, id string) (string, map[string]interface{}) {
+	t.Helper()
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var msg wireMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("waiting for the reply to %s: %v", id, err)
+		}
+		if msg.Type != "ACK" && msg.Type != "NACK" {
+			continue
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(msg.Payload, &payload)
+		if payload["id"] == id {
+			return msg.Type, payload
+		}
+	}
+}
+
+func TestResentRequestGetsCachedReply(t *testing.T) {
+	s, ts := newTestServer(t, testConfig(), nil)
+	conn := dialWS(t, ts, "")
+
+	request(t, conn, "join", "JOIN_QUEUE", map[string]string{"username": "alice"})
+	if typ, _ := reply(t, conn, "join"); typ != "ACK" {
+		t.Fatalf("JOIN_QUEUE got %s", typ)
+	}
+	request(t, conn, "leave", "LEAVE_QUEUE", nil)
+	if typ, _ := reply(t, conn, "leave"); typ != "ACK" {
+		t.Fatalf("LEAVE_QUEUE got %s", typ)
+	}
+
+	// Handling LEAVE_QUEUE again would fail with NOT_IN_QUEUE
+	request(t, conn, "leave", "LEAVE_QUEUE", nil)
+	if typ, payload := reply(t, conn, "leave"); typ != "ACK" {
+		t.Errorf("resent LEAVE_QUEUE got %s %v, want the original ACK", typ, payload["code"])
+	}
+
+	// Handling JOIN_QUEUE again would queue the player a second time
+	request(t, conn, "join", "JOIN_QUEUE", map[string]string{"username": "alice"})
+	if typ, _ := reply(t, conn, "join"); typ != "ACK" {
+		t.Errorf("resent JOIN_QUEUE got %s", typ)
+	}
+	if n := len(s.Matchmaker.Entries()); n != 0 {
+		t.Errorf("resent JOIN_QUEUE was handled again: %d queued", n)
+	}
+
+	request(t, conn, "again", "LEAVE_QUEUE", nil)
+	if typ, payload := reply(t, conn, "again"); typ != "NACK" || payload["code"] != "NOT_IN_QUEUE" {
+		t.Errorf("new request ID got %s %v, want NACK NOT_IN_QUEUE", typ, payload["code"])
+	}
+}
+
+func TestReconnectDuringNotice(t *testing.T) {
+	s, ts := newTestServer(t, testConfig(), nil)
+	alice, bob := dialWS(t, ts, ""), dialWS(t, ts, "")
+	request(t, alice, "1", "JOIN_QUEUE", map[string]string{"username": "alice"})
+	request(t, bob, "1", "JOIN_QUEUE", map[string]string{"username": "bob"})
+
+	var start struct {
+		ReconnectToken string `json:"reconnectToken"`
+	}
+	json.Unmarshal(readType(t, alice, "GAME_START").Payload, &start)
+	readType(t, bob, "GAME_START")
+	token := start.ReconnectToken
+
+	notice := game.Message{Type: game.MsgServerNotice, Payload: game.ServerNoticePayload{Message: "Restarting soon", Level: game.NoticeInfo}}
+	for i := 0; i < 10; i++ {
+		alice.Close()
+		readType(t, bob, "PLAYER_STATUS")
+
+		// Notices go out while the new connection takes over alice's seat;
+		// run with -race to catch both writing to it at once
+		alice = dialWS(t, ts, "")
+		stop, done := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, c := range s.clients.All() {
+					c.notify(notice)
+				}
+			}
+		}()
+		request(t, alice, "r", "RECONNECT", map[string]string{"token": token})
+
+		var reconnect struct {
+			ReconnectToken string `json:"reconnectToken"`
+		}
+		json.Unmarshal(readType(t, alice, "RECONNECT").Payload, &reconnect)
+		close(stop)
+		<-done
+		token = reconnect.ReconnectToken
+		readType(t, bob, "PLAYER_STATUS")
+	}
+}
@@ -7,9 +7,9 @@ import (
 	"4-in-a-row/analytics"
 	"4-in-a-row/config"
 	"4-in-a-row/db"
+	"4-in-a-row/game"
 	"4-in-a-row/handlers"
-
-	"github.com/rs/cors"
+	"4-in-a-row/oidc/mockidp"
 )
 
 func main() {
@@ -17,20 +17,23 @@ func main() {
 
 	cfg := config.Load()
 
-	if err := db.InitDB(); err != nil {
+	store, err := db.Open(cfg.DatabaseURL)
+	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
 	streamConfig := make(map[string]string)
+	var stream analytics.EventStream = analytics.NopStream{}
 
 	switch cfg.EventStream {
 	case "kafka":
 		if cfg.KafkaBrokers != "" {
 			streamConfig["brokers"] = cfg.KafkaBrokers
 			streamConfig["topic"] = cfg.KafkaTopic
-			if err := analytics.InitEventStream("kafka", streamConfig); err != nil {
+			if s, err := analytics.NewEventStream("kafka", streamConfig); err != nil {
 				log.Printf("Failed to initialize Kafka: %v", err)
 			} else {
+				stream = s
 				log.Println("Kafka analytics enabled")
 			}
 		} else {
@@ -41,9 +44,10 @@ func main() {
 			streamConfig["url"] = cfg.RedisURL
 			streamConfig["password"] = cfg.RedisPassword
 			streamConfig["stream"] = cfg.RedisStream
-			if err := analytics.InitEventStream("redis", streamConfig); err != nil {
+			if s, err := analytics.NewEventStream("redis", streamConfig); err != nil {
 				log.Printf("Failed to initialize Redis: %v", err)
 			} else {
+				stream = s
 				log.Println("Redis Streams analytics enabled")
 			}
 		} else {
@@ -51,38 +55,29 @@ func main() {
 		}
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", handlers.RootHandler)
-	mux.HandleFunc("/health", handlers.HealthHandler)
-	mux.HandleFunc("/ws", handlers.WSHandler)
-	mux.HandleFunc("/leaderboard", handlers.LeaderboardHandler)
-	mux.HandleFunc("/metrics", handlers.GameMetricsHandler)
-	mux.HandleFunc("/recent-games", handlers.RecentGamesHandler)
+	// Stand-in login provider for local development
+	if cfg.OIDCMockAddr != "" {
+		idp, err := mockidp.New(cfg.OIDCClientID, cfg.OIDCClientSecret)
+		if err != nil {
+			log.Fatalf("Failed to start mock OIDC provider: %v", err)
+		}
+		idp.Issuer = cfg.OIDCIssuer
+		go func() {
+			log.Printf("Mock OIDC provider listening on %s", cfg.OIDCMockAddr)
+			if err := http.ListenAndServe(cfg.OIDCMockAddr, idp); err != nil {
+				log.Printf("Mock OIDC provider stopped: %v", err)
+			}
+		}()
+	}
 
-	// CORS
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{
-			"http://localhost:3000",
-			"https://four-in-a-row.myselfankit.tech",
-		},
-		AllowedMethods: []string{
-			http.MethodGet,
-			http.MethodPost,
-			http.MethodPut,
-			http.MethodPatch,
-			http.MethodDelete,
-		},
-		AllowedHeaders: []string{
-			"Content-Type",
-			"Authorization",
-		},
-		AllowCredentials: true,
-	})
+	server := handlers.NewServer(cfg, store, stream, game.RealClock{})
+	defer server.Close()
 
-	handler := c.Handler(mux)
+	// Restore games that were in progress when the server last stopped
+	server.Games.RecoverGames()
 
 	log.Printf("Server listening on :%s", cfg.Port)
-	if err := http.ListenAndServe(":"+cfg.Port, handler); err != nil {
+	if err := http.ListenAndServe(":"+cfg.Port, server.Routes()); err != nil {
 		log.Fatal("Server error: ", err)
 	}
 }
@@ -0,0 +1,85 @@
+package names
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// scripts a name's letters may come from. Han, Hiragana and Katakana count
+// as one script since Japanese mixes them.
+var scripts = []struct {
+	name   string
+	tables []*unicode.RangeTable
+}{
+	{"Latin", []*unicode.RangeTable{unicode.Latin}},
+	{"Greek", []*unicode.RangeTable{unicode.Greek}},
+	{"Cyrillic", []*unicode.RangeTable{unicode.Cyrillic}},
+	{"Armenian", []*unicode.RangeTable{unicode.Armenian}},
+	{"Hebrew", []*unicode.RangeTable{unicode.Hebrew}},
+	{"Arabic", []*unicode.RangeTable{unicode.Arabic}},
+	{"Devanagari", []*unicode.RangeTable{unicode.Devanagari}},
+	{"Thai", []*unicode.RangeTable{unicode.Thai}},
+	{"Hangul", []*unicode.RangeTable{unicode.Hangul}},
+	{"Japanese", []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana}},
+}
+
+// script names the script of a letter; other letters each get their own
+// range table name so they never mix either
+func script(r rune) string {
+	if !unicode.IsLetter(r) {
+		return ""
+	}
+	for _, s := range scripts {
+		if unicode.In(r, s.tables...) {
+			return s.name
+		}
+	}
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return "Unknown"
+}
+
+// lookalikes maps characters to the Latin letter they are commonly mistaken
+// for. Digits are included so "B0t" and "Bot" share a skeleton. Letters with
+// accents need no entry: Skeleton decomposes them first, so "ё" is looked up
+// as "е".
+var lookalikes = map[rune]rune{
+	'0': 'o', '1': 'l', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'i': 'l',
+
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'з': 'e', 'і': 'l',
+	'ј': 'l', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c',
+	'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'ь': 'b', 'п': 'n', 'г': 'r',
+
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y', 'ω': 'w',
+}
+
+// multiLookalikes are letter pairs that read as one letter
+var multiLookalikes = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// Skeleton reduces name to the form lookalike names share: case, accents,
+// separators and confusable characters are folded away. Two names with the
+// same skeleton are treated as the same name.
+func Skeleton(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(strings.ToLower(name)) {
+		switch {
+		case unicode.IsMark(r), isSeparator(r), unicode.IsSpace(r):
+			continue
+		}
+		if l, ok := lookalikes[r]; ok {
+			r = l
+		}
+		b.WriteRune(r)
+	}
+	return multiLookalikes.Replace(b.String())
+}
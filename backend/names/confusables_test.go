@@ -0,0 +1,55 @@
+package names
+
+import (
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestSkeleton(t *testing.T) {
+	tests := []struct {
+		name, a, b string
+	}{
+		{"case", "Alice", "ALICE"},
+		{"separators", "a_l-i.c e", "alice"},
+		{"digits", "B0t", "bot"},
+		{"accents", "Zoë", "zoe"},
+		{"cyrillic a", "аlice", "alice"},
+		{"cyrillic word", "вот", "bot"},
+		{"cyrillic yo", "ё", "e"},
+		{"cyrillic yi", "ї", "l"},
+		{"greek", "αβε", "abe"},
+		{"fullwidth", "ａｌｉｃｅ", "alice"},
+		{"letter pairs", "rnod", "mod"},
+		{"i and l", "Iris", "lrls"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, b := Skeleton(tt.a), Skeleton(tt.b); a != b {
+				t.Errorf("Skeleton(%q) = %q, Skeleton(%q) = %q; want them equal", tt.a, a, tt.b, b)
+			}
+		})
+	}
+}
+
+func TestSkeletonKeepsDistinctNames(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"alice", "alicia"},
+		{"bob", "rob"},
+		{"дima", "dima"}, // Cyrillic de is not a lookalike of d
+	} {
+		if Skeleton(pair[0]) == Skeleton(pair[1]) {
+			t.Errorf("%q and %q share the skeleton %q", pair[0], pair[1], Skeleton(pair[0]))
+		}
+	}
+}
+
+func TestLookalikesAreReachable(t *testing.T) {
+	// Skeleton decomposes before looking characters up, so an entry for a
+	// character with a decomposition would never be used
+	for r := range lookalikes {
+		if d := []rune(norm.NFKD.String(string(r))); len(d) != 1 || d[0] != r {
+			t.Errorf("lookalike %q decomposes to %q", r, string(d))
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Package names decides which usernames players may use. Names are NFKC
+// normalized, limited in length and character classes, and compared by a
+// lookalike skeleton against reserved names and the blocklist.
+package names
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Length limits, in characters after normalization
+const (
+	MinLength = 2
+	MaxLength = 24
+)
+
+// Policy violations; each maps to its own client-facing error code
+var (
+	ErrLength     = errors.New("username must be 2 to 24 characters")
+	ErrCharacters = errors.New("username may only use letters and digits from one script, with single spaces, '_', '-' or '.' between them")
+	ErrReserved   = errors.New("that username is reserved")
+	ErrBlocked    = errors.New("that username is not allowed")
+)
+
+// reserved names belong to the server, bots or the history format (a game
+// result's winner is "draw" for a draw)
+var reserved = []string{
+	"admin", "administrator", "anonymous", "bot", "draw", "guest", "mod",
+	"moderator", "null", "root", "server", "staff", "support", "system",
+	"undefined",
+}
+
+// defaultBlocklist is extended with USERNAME_BLOCKLIST. Entries match
+// anywhere in a name, after both are reduced to skeletons, so that
+// "xXfuckXx" and "f.u.c.k" are caught. Matching inside words also catches
+// innocent names such as "Scunthorpe"; those go on the allowlist.
+var defaultBlocklist = []string{
+	"asshole", "bitch", "cunt", "fuck", "nigger", "shit", "whore",
+}
+
+// defaultAllowlist is extended with USERNAME_ALLOWLIST. It holds words that
+// contain a blocked word but are fine on their own; they are taken out of a
+// name before it is checked against the blocklist.
+var defaultAllowlist = []string{
+	"mishit", "scunthorpe", "shitake",
+}
+
+// Policy validates usernames against the reserved names and a blocklist
+type Policy struct {
+	reserved map[string]bool
+	blocked  []string
+	allowed  *strings.Replacer
+}
+
+// NewPolicy builds a policy that blocks the default words plus blocklist,
+// except inside the default words plus allowlist
+func NewPolicy(blocklist, allowlist []string) *Policy {
+	p := &Policy{reserved: make(map[string]bool, len(reserved))}
+	for _, name := range reserved {
+		p.reserved[Skeleton(name)] = true
+	}
+	for _, word := range append(defaultBlocklist, blocklist...) {
+		if s := Skeleton(word); s != "" {
+			p.blocked = append(p.blocked, s)
+		}
+	}
+	// Allowed words are cut out with a separator in their place, so the
+	// letters around them do not join up into a blocked word
+	var cuts []string
+	for _, word := range append(defaultAllowlist, allowlist...) {
+		if s := Skeleton(word); s != "" {
+			cuts = append(cuts, s, " ")
+		}
+	}
+	p.allowed = strings.NewReplacer(cuts...)
+	return p
+}
+
+// Normalize checks name against the policy and returns the form it is
+// stored and shown in
+func (p *Policy) Normalize(name string) (string, error) {
+	name = Clean(name)
+
+	if n := utf8.RuneCountInString(name); n < MinLength || n > MaxLength {
+		return "", ErrLength
+	}
+	if !validCharacters(name) {
+		return "", ErrCharacters
+	}
+
+	skeleton := Skeleton(name)
+	if p.reserved[skeleton] {
+		return "", ErrReserved
+	}
+	checked := p.allowed.Replace(skeleton)
+	for _, word := range p.blocked {
+		if strings.Contains(checked, word) {
+			return "", ErrBlocked
+		}
+	}
+	return name, nil
+}
+
+// Clean puts name in normal form without checking it: NFKC normalized,
+// trimmed, and with runs of whitespace collapsed to one space
+func Clean(name string) string {
+	return strings.Join(strings.Fields(norm.NFKC.String(name)), " ")
+}
+
+// validCharacters reports whether name is letters and digits of a single
+// script, with separators only between them
+func validCharacters(name string) bool {
+	runes := []rune(name)
+	if !isAlnum(runes[0]) || !isAlnum(runes[len(runes)-1]) {
+		return false
+	}
+
+	nameScript := ""
+	for i, r := range runes {
+		if isSeparator(r) {
+			if isSeparator(runes[i-1]) {
+				return false
+			}
+			continue
+		}
+		if unicode.IsMark(r) {
+			continue
+		}
+		if !isAlnum(r) {
+			return false
+		}
+		if s := script(r); s != "" {
+			if nameScript != "" && s != nameScript {
+				return false
+			}
+			nameScript = s
+		}
+	}
+	return true
+}
+
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isSeparator(r rune) bool {
+	return r == ' ' || r == '_' || r == '-' || r == '.'
+}
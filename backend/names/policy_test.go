@@ -0,0 +1,67 @@
+package names
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	p := NewPolicy([]string{"Badword"}, []string{"Goodbadwords"})
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  error
+	}{
+		{"plain", "alice", "alice", nil},
+		{"trimmed and collapsed", "  alice   smith ", "alice smith", nil},
+		{"separators", "a_b-c.d", "a_b-c.d", nil},
+		{"fullwidth", "ａｌｉｃｅ", "alice", nil},
+		{"one script", "Алиса", "Алиса", nil},
+		{"japanese", "ゆき太郎", "ゆき太郎", nil},
+		{"combining accent", "Zoë", "Zoë", nil},
+
+		{"too short", "a", "", ErrLength},
+		{"too long", strings.Repeat("a", MaxLength+1), "", ErrLength},
+		{"longest", strings.Repeat("a", MaxLength), strings.Repeat("a", MaxLength), nil},
+
+		{"symbol", "alice!", "", ErrCharacters},
+		{"leading separator", "_alice", "", ErrCharacters},
+		{"double separator", "al__ice", "", ErrCharacters},
+		{"zero-width space", "ali\u200bce", "", ErrCharacters},
+		{"zero-width joiner", "ali\u200dce", "", ErrCharacters},
+		{"cyrillic a in latin", "pаypal", "", ErrCharacters},
+		{"mixed scripts", "aliceΑλίκη", "", ErrCharacters},
+
+		{"reserved", "admin", "", ErrReserved},
+		{"reserved case", "ADMIN", "", ErrReserved},
+		{"reserved digits", "B0t", "", ErrReserved},
+		{"reserved separators", "a.d.m.i.n", "", ErrReserved},
+		{"reserved fullwidth", "ａｄｍｉｎ", "", ErrReserved},
+		{"reserved cyrillic", "вот", "", ErrReserved},
+		{"reserved containing", "admin_fan", "admin_fan", nil},
+
+		{"blocked", "fuck", "", ErrBlocked},
+		{"blocked inside", "xXfuckXx", "", ErrBlocked},
+		{"blocked separators", "f.u.c.k", "", ErrBlocked},
+		{"blocked digits", "sh1t", "", ErrBlocked},
+		{"blocked fullwidth", "ｆｕｃｋ", "", ErrBlocked},
+		{"blocked configured", "my_badword", "", ErrBlocked},
+
+		{"allowed", "Scunthorpe", "Scunthorpe", nil},
+		{"allowed separators", "Scun.thorpe", "Scun.thorpe", nil},
+		{"allowed configured", "goodbadwords", "goodbadwords", nil},
+		{"allowed next to blocked", "scunthorpe_fuck", "", ErrBlocked},
+		{"allowed does not join", "fu_scunthorpe_ck", "fu_scunthorpe_ck", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Normalize(tt.in)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("Normalize(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ import { GameResultModal } from '@/components/game-result-modal';
 import { Button } from '@/components/ui/button';
 import { Tabs, TabsContent, TabsList, TabsTrigger } from '@/components/ui/tabs';
 import { useWebSocketContext } from '@/lib/contexts';
+import { errorText } from '@/lib/websocket';
 import { fetchLeaderboard, fetchMetrics, fetchRecentGames } from '@/lib/api';
 import type {
   WSMessage,
@@ -20,6 +21,7 @@ import type {
   Grid,
   LastMove,
   RecentGame,
+  ServerNoticeMessage,
 } from '@/lib/types';
 import { Gamepad2, Trophy, Play, History } from 'lucide-react';
 import { Navbar } from '@/components/navbar';
@@ -40,6 +42,9 @@ export default function HomePage() {
   } = useWebSocketContext();
 
   const [error, setError] = useState<string | null>(null);
+  const [notice, setNotice] = useState<ServerNoticeMessage['payload'] | null>(
+    null
+  );
   const [isWaiting, setIsWaiting] = useState(false);
 
   // View state
@@ -86,6 +91,7 @@ export default function HomePage() {
             playerId: message.payload.you.playerId!,
             username: message.payload.you.username,
             gameId: message.payload.gameId,
+            reconnectToken: message.payload.reconnectToken,
           });
           setGameState({
             gameId: message.payload.gameId,
@@ -98,6 +104,7 @@ export default function HomePage() {
             yourTurn: message.payload.yourTurn,
             moveNumber: 0,
             status: 'active',
+            reconnectToken: message.payload.reconnectToken,
           });
           setViewMode('game');
           setIsWaiting(false);
@@ -114,7 +121,7 @@ export default function HomePage() {
               moveNumber: message.payload.moveNumber,
             };
           });
-          setLastMove(message.payload.lastMove);
+          setLastMove(message.payload.lastMove ?? null);
           break;
 
         case 'GAME_OVER':
@@ -135,6 +142,7 @@ export default function HomePage() {
             playerId: message.payload.you.playerId!,
             username: message.payload.you.username,
             gameId: message.payload.gameId,
+            reconnectToken: message.payload.reconnectToken,
           });
           setGameState({
             gameId: message.payload.gameId,
@@ -145,6 +153,7 @@ export default function HomePage() {
             yourTurn: message.payload.yourTurn,
             moveNumber: message.payload.moveNumber,
             status: 'active',
+            reconnectToken: message.payload.reconnectToken,
           });
           setViewMode('game');
           setIsWaiting(false);
@@ -173,20 +182,26 @@ export default function HomePage() {
           });
           break;
 
-        case 'ERROR':
-          setError(message.payload);
+        case 'SERVER_NOTICE':
+          setNotice(message.payload);
+          break;
+
+        case 'ERROR': {
+          const text = errorText(message.payload);
+          setError(text);
           setIsWaiting(false);
-          if (message.payload.includes('not found')) {
+          if (text.includes('not found')) {
             removeSession();
           }
           // If error says already in game, stop waiting and stay in current view
           if (
-            message.payload.includes('already in') ||
-            message.payload.includes('already playing')
+            text.includes('already in') ||
+            text.includes('already playing')
           ) {
             setIsWaiting(false);
           }
           break;
+        }
       }
     },
     [saveSession, removeSession]
@@ -259,11 +274,12 @@ export default function HomePage() {
     const handleVisibilityChange = () => {
       if (document.hidden && (isWaiting || gameState?.status === 'active')) {
         // Update disconnect timestamp when tab becomes hidden
-        if (gameState) {
+        if (gameState?.reconnectToken) {
           saveSession({
             playerId: gameState.you.playerId!,
             username: gameState.you.username,
             gameId: gameState.gameId,
+            reconnectToken: gameState.reconnectToken,
             disconnectTime: Date.now(),
           });
         }
@@ -283,6 +299,24 @@ export default function HomePage() {
       {/* Header */}
       <Navbar viewMode={viewMode} gameState={gameState} />
 
+      {/* Operator notice */}
+      {notice && (
+        <div
+          className={`border-b px-4 py-2 text-sm ${
+            notice.level === 'warning'
+              ? 'bg-destructive/10 text-destructive'
+              : 'bg-muted text-foreground'
+          }`}
+        >
+          <div className="container mx-auto flex items-center justify-between gap-4">
+            <span>{notice.message}</span>
+            <Button variant="ghost" size="sm" onClick={() => setNotice(null)}>
+              Dismiss
+            </Button>
+          </div>
+        </div>
+      )}
+
       {/* Main content */}
       <main className="container mx-auto px-4 py-6">
         <div className="grid gap-6 lg:grid-cols-12">
@@ -8,7 +8,7 @@ import {
   DialogHeader,
   DialogTitle,
 } from '@/components/ui/dialog';
-import { Trophy, Frown, Handshake } from 'lucide-react';
+import { Trophy, Frown, Handshake, Ban } from 'lucide-react';
 
 interface GameResultModalProps {
   isOpen: boolean;
@@ -25,14 +25,17 @@ export function GameResultModal({
 }: GameResultModalProps) {
   const isWinner = winner === yourUsername;
   const isDraw = winner === 'draw';
+  const isAborted = !winner;
 
   const getTitle = () => {
+    if (isAborted) return 'Game Aborted';
     if (isDraw) return "It's a Draw!";
     if (isWinner) return 'You Won!';
     return 'You Lost';
   };
 
   const getIcon = () => {
+    if (isAborted) return <Ban className="h-16 w-16 text-muted-foreground" />;
     if (isDraw)
       return <Handshake className="h-16 w-16 text-muted-foreground" />;
     if (isWinner) return <Trophy className="h-16 w-16 text-player-2" />;
@@ -46,7 +49,9 @@ export function GameResultModal({
           <div className="flex justify-center mb-4">{getIcon()}</div>
           <DialogTitle className="text-2xl">{getTitle()}</DialogTitle>
           <DialogDescription>
-            {isDraw
+            {isAborted
+              ? 'The server ended this game without a result.'
+              : isDraw
               ? 'Great game! Neither player could claim victory.'
               : isWinner
                 ? 'Congratulations on your victory!'
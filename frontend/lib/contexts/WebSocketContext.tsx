@@ -18,12 +18,12 @@ import {
   clearSession,
   type GameSession,
 } from '../websocket';
-import type { WSMessage, ConnectionState } from '../types';
+import type { WSMessage, WSRequest, ConnectionState } from '../types';
 
 interface WebSocketContextValue {
   connectionState: ConnectionState;
   isConnected: boolean;
-  sendMessage: (message: { type: string; payload: unknown }) => void;
+  sendMessage: (message: WSRequest) => void;
   reconnect: () => void;
   saveSession: (session: GameSession) => void;
   removeSession: () => void;
@@ -126,7 +126,7 @@ export function WebSocketProvider({ children }: WebSocketProviderProps) {
             console.log('Attempting to reconnect to existing session');
             sendWSMessage(wsRef.current, {
               type: 'RECONNECT',
-              payload: session.playerId,
+              payload: { token: session.reconnectToken },
             });
           } else {
             console.log('Session expired (>5 min), clearing session');
@@ -158,7 +158,7 @@ export function WebSocketProvider({ children }: WebSocketProviderProps) {
 
   // Send a message
   const sendMessage = useCallback(
-    (message: { type: string; payload: unknown }) => {
+    (message: WSRequest) => {
       if (!wsRef.current) {
         console.warn('Cannot send message: WebSocket not connected');
         return;
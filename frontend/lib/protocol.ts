@@ -0,0 +1,284 @@
+// Code generated by cmd/protocolgen from backend/game; DO NOT EDIT.
+
+export const PROTOCOL_VERSION = 2;
+
+export interface HelloPayload {
+  version: number;
+  features: string[];
+}
+
+export interface JoinQueuePayload {
+  username: string;
+}
+
+/** ReconnectRequest is the RECONNECT payload; the token may also be sent as a bare string */
+export interface ReconnectRequest {
+  /** Reconnect token from GAME_START, RECONNECT or RESUMED */
+  token: string;
+  /** Last sequence number the client processed */
+  lastSeq?: number;
+}
+
+export interface MovePayload {
+  gameId: string;
+  column: number | null;
+}
+
+/** SyncRequest asks for a full snapshot of a game */
+export interface SyncRequest {
+  gameId: string;
+}
+
+export interface LobbySubscribePayload {
+  username: string;
+}
+
+/** ChallengeRequest is the CHALLENGE_POST payload */
+export interface ChallengeRequest {
+  rules: string;
+  timeControl: string;
+  rated: boolean;
+}
+
+/** ChallengeRef names a challenge in CHALLENGE_CANCEL, CHALLENGE_ACCEPT and CHALLENGE_DECLINE */
+export interface ChallengeRef {
+  challengeId: string;
+}
+
+/** DirectChallengeRequest is the CHALLENGE payload, challenging one friend instead of the whole lobby */
+export interface DirectChallengeRequest {
+  /** Account ID of the friend */
+  userId: string;
+  rules: string;
+  timeControl: string;
+  rated: boolean;
+}
+
+export interface WelcomePayload {
+  /** Version used for this connection */
+  version: number;
+  /** Newest version the server speaks */
+  serverVersion: number;
+  minVersion: number;
+  /** Features enabled for this connection */
+  features: string[];
+  deprecated?: boolean;
+  /** When the agreed version stops being accepted */
+  sunset?: string;
+}
+
+/** AckPayload confirms that the request with the given ID succeeded */
+export interface AckPayload {
+  id: string;
+  /** Type of the acknowledged request */
+  type: string;
+}
+
+/** NackPayload reports that the request with the given ID failed */
+export interface NackPayload {
+  id: string;
+  type: string;
+  code: string;
+  message: string;
+  /** What the client lacked, with PERMISSION_DENIED and LOGIN_REQUIRED */
+  permission?: string;
+}
+
+/** ErrorPayload is the ERROR payload for clients on protocol version 2 and later */
+export interface ErrorPayload {
+  code: string;
+  message: string;
+  /** What the client lacked, with PERMISSION_DENIED and LOGIN_REQUIRED */
+  permission?: string;
+  /** The client message that caused the error */
+  request?: RequestSummary;
+}
+
+/** RequestSummary identifies the client message an error or reply refers to */
+export interface RequestSummary {
+  type: string;
+  payload?: unknown;
+}
+
+/** QueueStatusPayload tells a waiting player where they stand in matchmaking */
+export interface QueueStatusPayload {
+  inQueue: boolean;
+  /** 1-based */
+  position?: number;
+  playersWaiting: number;
+  elapsedSeconds: number;
+  /** Seconds until a bot game starts */
+  botFallbackIn: number;
+}
+
+export interface GameStartPayload {
+  gameId: string;
+  you: PlayerInfo;
+  opponent: PlayerInfo;
+  yourTurn: boolean;
+  /** Send in RECONNECT to reclaim this seat */
+  reconnectToken: string;
+}
+
+export interface PlayerInfo {
+  /** Only for "you" */
+  playerId?: string;
+  username: string;
+  symbol: number;
+  /** "human" or "bot" */
+  type: string;
+  isOnline: boolean;
+}
+
+export interface GameUpdatePayload {
+  grid: number[][];
+  /** 1 or 2 */
+  currentTurn: number;
+  lastMove?: LastMove;
+  moveNumber: number;
+}
+
+export interface LastMove {
+  player: number;
+  column: number;
+  row: number;
+}
+
+/** DeltaPayload is the GAME_DELTA sent instead of GAME_UPDATE to clients that agreed on FeatureDeltas. It only describes the move; Hash lets the client check its own board and ask for SYNC if they differ. */
+export interface DeltaPayload {
+  column: number;
+  row: number;
+  player: number;
+  moveNumber: number;
+  currentTurn: number;
+  hash: string;
+}
+
+/** SyncPayload is the full position sent in reply to SYNC */
+export interface SyncPayload {
+  gameId: string;
+  grid: number[][];
+  currentTurn: number;
+  lastMove?: LastMove;
+  moveNumber: number;
+  hash: string;
+}
+
+export interface GameOverPayload {
+  /** Winner's username, "draw", or empty when aborted without a result */
+  winner: string;
+  /** Set when the game did not end on the board, e.g. "aborted" */
+  reason?: string;
+}
+
+export interface ReconnectPayload {
+  gameId: string;
+  you: PlayerInfo;
+  opponent: PlayerInfo;
+  grid: number[][];
+  currentTurn: number;
+  yourTurn: boolean;
+  moveNumber: number;
+  /** Renewed token for the next reconnect */
+  reconnectToken: string;
+}
+
+/** ResumedPayload confirms a resumed session after the missed messages were replayed */
+export interface ResumedPayload {
+  gameId: string;
+  /** Sequence number the client resumed from */
+  lastSeq: number;
+  /** Number of messages replayed */
+  replayed: number;
+  /** Renewed token for the next reconnect */
+  reconnectToken: string;
+}
+
+export interface PlayerStatusPayload {
+  playerSymbol: number;
+  isOnline: boolean;
+  /** Seconds left before forfeit (0 if online) */
+  timeLeft: number;
+  /** Round-trip time of the player's connection */
+  latencyMs?: number;
+  /** "good", "fair" or "poor" */
+  quality?: string;
+}
+
+/** LobbyStatePayload is the LOBBY_STATE snapshot sent on subscribe */
+export interface LobbyStatePayload {
+  members: LobbyMember[];
+  challenges: ChallengeInfo[];
+}
+
+export interface LobbyMember {
+  username: string;
+  status: string;
+}
+
+/** ChallengeInfo is an open challenge as shown on the board, or a direct challenge as sent to its creator and opponent */
+export interface ChallengeInfo {
+  challengeId: string;
+  creator: string;
+  /** Set on direct challenges */
+  opponent?: string;
+  rules: string;
+  timeControl: string;
+  rated: boolean;
+}
+
+/** LobbyPresencePayload is pushed whenever a member joins, leaves or changes status */
+export interface LobbyPresencePayload {
+  username: string;
+  status?: string;
+  online: boolean;
+}
+
+export interface ChallengeRemovedPayload {
+  challengeId: string;
+  reason: string;
+}
+
+/** ServerNoticePayload is an operator's announcement to every connected client */
+export interface ServerNoticePayload {
+  message: string;
+  /** "info" or "warning" */
+  level: string;
+}
+
+export type ClientMessage =
+  | { id?: string; type: 'HELLO'; payload: HelloPayload }
+  | { id?: string; type: 'JOIN_QUEUE'; payload: JoinQueuePayload | string }
+  | { id?: string; type: 'LEAVE_QUEUE'; payload?: null }
+  | { id?: string; type: 'RECONNECT'; payload: ReconnectRequest | string }
+  | { id?: string; type: 'MOVE'; payload: MovePayload }
+  | { id?: string; type: 'SYNC'; payload: SyncRequest }
+  | { id?: string; type: 'LOBBY_SUBSCRIBE'; payload: LobbySubscribePayload }
+  | { id?: string; type: 'LOBBY_UNSUBSCRIBE'; payload?: null }
+  | { id?: string; type: 'CHALLENGE_POST'; payload: ChallengeRequest }
+  | { id?: string; type: 'CHALLENGE_CANCEL'; payload: ChallengeRef }
+  | { id?: string; type: 'CHALLENGE_ACCEPT'; payload: ChallengeRef }
+  | { id?: string; type: 'CHALLENGE'; payload: DirectChallengeRequest }
+  | { id?: string; type: 'CHALLENGE_DECLINE'; payload: ChallengeRef };
+
+export type ServerMessage =
+  | { type: 'WELCOME'; payload: WelcomePayload; seq?: number }
+  | { type: 'ACK'; payload: AckPayload; seq?: number }
+  | { type: 'NACK'; payload: NackPayload; seq?: number }
+  | { type: 'ERROR'; payload: ErrorPayload | string; seq?: number }
+  | { type: 'QUEUE_STATUS'; payload: QueueStatusPayload; seq?: number }
+  | { type: 'GAME_START'; payload: GameStartPayload; seq?: number }
+  | { type: 'GAME_UPDATE'; payload: GameUpdatePayload; seq?: number }
+  | { type: 'GAME_DELTA'; payload: DeltaPayload; seq?: number }
+  | { type: 'SYNC'; payload: SyncPayload; seq?: number }
+  | { type: 'GAME_OVER'; payload: GameOverPayload; seq?: number }
+  | { type: 'RECONNECT'; payload: ReconnectPayload; seq?: number }
+  | { type: 'RESUMED'; payload: ResumedPayload; seq?: number }
+  | { type: 'PLAYER_STATUS'; payload: PlayerStatusPayload; seq?: number }
+  | { type: 'LOBBY_STATE'; payload: LobbyStatePayload; seq?: number }
+  | { type: 'LOBBY_PRESENCE'; payload: LobbyPresencePayload; seq?: number }
+  | { type: 'CHALLENGE_POSTED'; payload: ChallengeInfo; seq?: number }
+  | { type: 'CHALLENGE_REMOVED'; payload: ChallengeRemovedPayload; seq?: number }
+  | { type: 'CHALLENGE_RECEIVED'; payload: ChallengeInfo; seq?: number }
+  | { type: 'CHALLENGE_SENT'; payload: ChallengeInfo; seq?: number }
+  | { type: 'SERVER_NOTICE'; payload: ServerNoticePayload; seq?: number };
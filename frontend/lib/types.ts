@@ -1,17 +1,13 @@
-export type PlayerSymbol = 1 | 2;
-export type PlayerType = 'human' | 'bot';
-export type CellValue = 0 | 1 | 2;
-export type Grid = CellValue[][];
+// WebSocket messages and their payloads are generated from the server's
+// message catalog into ./protocol; only UI state and HTTP responses are
+// declared here.
+import type { ClientMessage, ServerMessage, PlayerInfo } from './protocol';
 
-// ============= Player Info =============
+export type * from './protocol';
 
-export interface PlayerInfo {
-  playerId?: string;
-  username: string;
-  symbol: PlayerSymbol;
-  type: PlayerType;
-  isOnline: boolean;
-}
+export type PlayerSymbol = PlayerInfo['symbol']; // 1 or 2
+export type CellValue = number; // 0 for empty, else a PlayerSymbol
+export type Grid = CellValue[][];
 
 // ============= Game State =============
 
@@ -25,87 +21,23 @@ export interface GameState {
   moveNumber: number;
   status: 'waiting' | 'active' | 'finished';
   winner?: string;
-}
-
-// ============= Move Data =============
-
-export interface MoveData {
-  moveNumber: number;
-  player: PlayerSymbol;
-  column: number;
-  row: number;
-  timestamp: number;
-}
-
-export interface LastMove {
-  player: PlayerSymbol;
-  column: number;
-  row: number;
+  reconnectToken?: string;
 }
 
 // ============= WebSocket Messages =============
 
-export type WSMessage =
-  | GameStartMessage
-  | GameUpdateMessage
-  | GameOverMessage
-  | ReconnectMessage
-  | PlayerStatusMessage
-  | ErrorMessage;
+export type WSMessage = ServerMessage;
+export type WSRequest = ClientMessage;
 
-export interface GameStartMessage {
-  type: 'GAME_START';
-  payload: {
-    gameId: string;
-    you: PlayerInfo;
-    opponent: PlayerInfo;
-    yourTurn: boolean;
-  };
-}
+// MessageOf picks one message type out of the ServerMessage union
+export type MessageOf<T extends ServerMessage['type']> = Extract<
+  ServerMessage,
+  { type: T }
+>;
 
-export interface GameUpdateMessage {
-  type: 'GAME_UPDATE';
-  payload: {
-    grid: Grid;
-    currentTurn: PlayerSymbol;
-    lastMove: LastMove | null;
-    moveNumber: number;
-  };
-}
-
-export interface GameOverMessage {
-  type: 'GAME_OVER';
-  payload: {
-    winner: string;
-  };
-}
-
-export interface ReconnectMessage {
-  type: 'RECONNECT';
-  payload: {
-    gameId: string;
-    you: PlayerInfo;
-    opponent: PlayerInfo;
-    grid: Grid;
-    currentTurn: PlayerSymbol;
-    yourTurn: boolean;
-    moveNumber: number;
-  };
-}
-
-export interface ErrorMessage {
-  type: 'ERROR';
-  payload: string;
-}
-
-export interface PlayerStatusMessage {
-  type: 'PLAYER_STATUS';
-  payload: {
-    playerSymbol: PlayerSymbol;
-    isOnline: boolean;
-    timeLeft: number;
-  };
-}
+export type PlayerStatusMessage = MessageOf<'PLAYER_STATUS'>;
+export type ServerNoticeMessage = MessageOf<'SERVER_NOTICE'>;
+export type ErrorMessage = MessageOf<'ERROR'>;
 
 // ============= API Responses =============
 
@@ -120,6 +52,12 @@ export interface GameMetrics {
   averageDuration: number;
   gamesToday: number;
   recentActivity: HourlyActivity[];
+  limits?: {
+    oversizedMessages: number;
+    rateLimitedMessages: number;
+    rejectedConnections: number;
+    closedConnections: number;
+  };
 }
 
 export interface HourlyActivity {
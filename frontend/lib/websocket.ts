@@ -1,6 +1,6 @@
 // WebSocket client for real-time game communication
 
-import type { WSMessage } from './types';
+import type { ErrorMessage, WSMessage, WSRequest } from './types';
 import { config } from './config';
 
 // Session storage keys
@@ -13,6 +13,7 @@ export interface GameSession {
   playerId: string;
   username: string;
   gameId: string;
+  reconnectToken: string; // Signed by the server, proves the seat is ours
   disconnectTime?: number; // Timestamp when user disconnected
 }
 
@@ -88,10 +89,7 @@ export function createWebSocket(): WebSocket {
  * @param ws - The WebSocket instance
  * @param message - The message to send
  */
-export function sendMessage(
-  ws: WebSocket | null,
-  message: { type: string; payload: unknown }
-): void {
+export function sendMessage(ws: WebSocket | null, message: WSRequest): void {
   if (!ws) {
     console.warn('WebSocket is null. Message not sent:', message);
     return;
@@ -117,3 +115,13 @@ export function parseMessage(data: string): WSMessage | null {
     return null;
   }
 }
+
+/**
+ * Get the text of an ERROR payload, which is a plain string for clients
+ * that did not send HELLO
+ * @param payload - The ERROR payload
+ * @returns The error message
+ */
+export function errorText(payload: ErrorMessage['payload']): string {
+  return typeof payload === 'string' ? payload : payload.message;
+}